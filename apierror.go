@@ -0,0 +1,132 @@
+package messenger
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// JSON error codes of the Discord API often met by webhooks.
+// https://discord.com/developers/docs/topics/opcodes-and-status-codes#json
+const (
+	CodeUnknownChannel          = 10003
+	CodeUnknownMessage          = 10008
+	CodeUnknownWebhook          = 10015
+	CodeMissingAccess           = 50001
+	CodeMissingPermissions      = 50013
+	CodeInvalidWebhookToken     = 50027
+	CodeInvalidFormBody         = 50035
+	CodeWebhookForumThreadLimit = 220001 // Forum channels need thread_name or thread_id.
+)
+
+// APIError is an error response of the Discord API. Use errors.As to branch on
+// its Code.
+// https://discord.com/developers/docs/reference#error-messages
+type APIError struct {
+	StatusCode int
+	// Code is the JSON error code, 0 when the response does not carry one.
+	Code    int
+	Message string
+	// Errors lists the invalid fields of the request body.
+	Errors []FieldError
+}
+
+// FieldError describes an invalid field of a request body.
+type FieldError struct {
+	// Path of the field, e.g. "embeds.0.fields.2.value".
+	Path    string
+	Code    string
+	Message string
+}
+
+func (e *APIError) Error() string {
+	var b strings.Builder
+	b.WriteString("Discord API error")
+	if e.Code != 0 {
+		fmt.Fprintf(&b, " %d", e.Code)
+	}
+	b.WriteString(": ")
+	b.WriteString(e.Message)
+	for i, f := range e.Errors {
+		if i == 0 {
+			b.WriteString(" (")
+		} else {
+			b.WriteString(", ")
+		}
+		fmt.Fprintf(&b, "%s: %s", f.Path, f.Message)
+	}
+	if len(e.Errors) > 0 {
+		b.WriteString(")")
+	}
+	return b.String()
+}
+
+// respError returns an *APIError when resp is an error response. Responses
+// without status error still carry one if their body has a "message" field.
+func respError(resp *http.Response) error {
+	var body struct {
+		Code    int             `json:"code"`
+		Message json.RawMessage `json:"message"`
+		Errors  json.RawMessage `json:"errors"`
+	}
+	failed := resp.StatusCode >= http.StatusBadRequest
+	err := json.NewDecoder(resp.Body).Decode(&body)
+	switch {
+	// Body is empty.
+	case err == io.EOF && !failed:
+		return nil
+	// Error responses from proxies in front of Discord may not be JSON.
+	case err != nil && !failed:
+		return err
+	case !failed && body.Message == nil:
+		return nil
+	}
+
+	apiErr := &APIError{StatusCode: resp.StatusCode, Code: body.Code}
+	// "message" is of string type, anything else is kept as raw JSON.
+	if body.Message != nil && json.Unmarshal(body.Message, &apiErr.Message) != nil {
+		apiErr.Message = string(body.Message)
+	}
+	if apiErr.Message == "" {
+		apiErr.Message = http.StatusText(resp.StatusCode)
+	}
+	flattenErrors("", body.Errors, &apiErr.Errors)
+	return apiErr
+}
+
+// flattenErrors walks the nested "errors" object of an error response, keys are
+// joined into the path of each field holding "_errors".
+func flattenErrors(path string, raw json.RawMessage, out *[]FieldError) {
+	var obj map[string]json.RawMessage
+	if json.Unmarshal(raw, &obj) != nil {
+		return
+	}
+	keys := make([]string, 0, len(obj))
+	for k := range obj {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		if k == "_errors" {
+			var errs []struct {
+				Code    string `json:"code"`
+				Message string `json:"message"`
+			}
+			json.Unmarshal(obj[k], &errs)
+			for _, e := range errs {
+				*out = append(*out, FieldError{Path: path, Code: e.Code, Message: e.Message})
+			}
+			continue
+		}
+
+		p := k
+		if path != "" {
+			p = path + "." + k
+		}
+		flattenErrors(p, obj[k], out)
+	}
+}
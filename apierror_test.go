@@ -0,0 +1,130 @@
+package messenger
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRespError(t *testing.T) {
+	type body struct {
+		Message string `json:"message,omitempty"`
+		Other   string `json:"other,omitempty"`
+	}
+
+	t.Run("Has error in response", func(t *testing.T) {
+		rawBody := body{Message: "test"}
+		jsonBody, _ := json.Marshal(rawBody)
+		rr := httptest.NewRecorder()
+		rr.Write(jsonBody)
+
+		err := respError(rr.Result())
+
+		require.Equal(t, &APIError{StatusCode: http.StatusOK, Message: "test"}, err, "Has error in response failed")
+		require.EqualError(t, err, "Discord API error: test", "Has error in response failed")
+	})
+
+	t.Run("Decode return if EOF", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		// Write empty body to trigger decode EOF error.
+		rr.Write(nil)
+
+		err := respError(rr.Result())
+
+		require.IsType(t, nil, err, "Decode return if EOF failed")
+	})
+
+	t.Run("Decode error", func(t *testing.T) {
+		body, _ := json.Marshal(1)
+		rr := httptest.NewRecorder()
+		// Write empty body to trigger decode EOF error.
+		rr.Write(body)
+
+		err := respError(rr.Result())
+
+		require.IsType(t, &json.UnmarshalTypeError{}, err, "Decode error failed")
+	})
+
+	t.Run("No error", func(t *testing.T) {
+		rawBody := body{Other: "Ok"}
+		jsonBody, _ := json.Marshal(rawBody)
+		rr := httptest.NewRecorder()
+		rr.Write(jsonBody)
+
+		err := respError(rr.Result())
+
+		require.Equal(t, nil, err, "Resp no error failed")
+	})
+
+	t.Run("Error status without body", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		rr.WriteHeader(http.StatusBadGateway)
+
+		err := respError(rr.Result())
+
+		require.Equal(t, &APIError{StatusCode: http.StatusBadGateway, Message: "Bad Gateway"}, err, "Error status without body failed")
+	})
+
+	t.Run("Error status with non JSON body", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		rr.WriteHeader(http.StatusServiceUnavailable)
+		rr.Write([]byte("<html>upstream error</html>"))
+
+		err := respError(rr.Result())
+
+		require.Equal(t, &APIError{StatusCode: http.StatusServiceUnavailable, Message: "Service Unavailable"}, err, "Error status with non JSON body failed")
+	})
+
+	t.Run("Message not string", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		rr.WriteHeader(http.StatusBadRequest)
+		rr.Write([]byte(`{"message": {"text": "odd"}}`))
+
+		err := respError(rr.Result())
+
+		require.Equal(t, &APIError{StatusCode: http.StatusBadRequest, Message: `{"text": "odd"}`}, err, "Message not string failed")
+	})
+
+	t.Run("Code and field errors", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		rr.WriteHeader(http.StatusBadRequest)
+		rr.Write([]byte(`{
+			"code": 50035,
+			"message": "Invalid Form Body",
+			"errors": {
+				"embeds": {"0": {"fields": {"2": {"value": {"_errors": [
+					{"code": "BASE_TYPE_MAX_LENGTH", "message": "Must be 1024 or fewer in length."}
+				]}}}}},
+				"content": {"_errors": [{"code": "BASE_TYPE_REQUIRED", "message": "This field is required"}]}
+			}
+		}`))
+
+		err := respError(rr.Result())
+
+		var apiErr *APIError
+		require.ErrorAs(t, err, &apiErr, "Code and field errors failed")
+		require.Equal(t, CodeInvalidFormBody, apiErr.Code, "Code and field errors failed")
+		require.Equal(t, []FieldError{
+			{Path: "content", Code: "BASE_TYPE_REQUIRED", Message: "This field is required"},
+			{Path: "embeds.0.fields.2.value", Code: "BASE_TYPE_MAX_LENGTH", Message: "Must be 1024 or fewer in length."},
+		}, apiErr.Errors, "Code and field errors failed")
+		require.EqualError(t, err, "Discord API error 50035: Invalid Form Body (content: This field is required, embeds.0.fields.2.value: Must be 1024 or fewer in length.)")
+	})
+
+	t.Run("Unknown webhook", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		rr.WriteHeader(http.StatusNotFound)
+		rr.Write([]byte(`{"message": "Unknown Webhook", "code": 10015}`))
+
+		err := respError(rr.Result())
+
+		var apiErr *APIError
+		require.ErrorAs(t, err, &apiErr, "Unknown webhook failed")
+		require.Equal(t, CodeUnknownWebhook, apiErr.Code, "Unknown webhook failed")
+		require.Equal(t, http.StatusNotFound, apiErr.StatusCode, "Unknown webhook failed")
+		require.EqualError(t, err, "Discord API error 10015: Unknown Webhook")
+	})
+}
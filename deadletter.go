@@ -0,0 +1,153 @@
+package messenger
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+)
+
+// DeadLetter is a message which cannot be sent as it is: it failed validation,
+// Discord rejected it with a 4xx error other than 429 or an Outbox removed it.
+type DeadLetter struct {
+	// Message is the message as passed to Send, before templates are merged
+	// and it is divided, with the content of its files.
+	Message Message
+	// Chunk is the position of the rejected message among the messages
+	// divided from Message.
+	Chunk int
+	Err   error
+	Time  time.Time
+}
+
+// DeadLetterSink receives the messages which cannot be sent, see
+// WithDeadLetters.
+type DeadLetterSink interface {
+	Put(ctx context.Context, dl DeadLetter) error
+}
+
+// WithDeadLetters puts the messages which cannot be sent into sink. Send still
+// returns their errors.
+func WithDeadLetters(sink DeadLetterSink) Option {
+	return func(c *Client) {
+		c.deadLetters = sink
+	}
+}
+
+// putDeadLetter puts origin, the message the divided message msg comes from,
+// into the dead letter sink of the Client. msg itself is put when origin is nil.
+func (c *Client) putDeadLetter(ctx context.Context, msg Message, origin *Message, err error) {
+	if c.deadLetters == nil {
+		return
+	}
+	dl := DeadLetter{Message: msg, Chunk: msg.part, Err: c.redactError(err), Time: time.Now()}
+	if origin != nil {
+		dl.Message = *origin
+	}
+	dl.Message.part = 0
+	if err := c.deadLetters.Put(ctx, dl); err != nil {
+		c.log(ctx, slog.LevelError, "storing dead letter failed", "error", err)
+	}
+}
+
+// MemoryDeadLetters keeps dead letters in memory. The zero value is ready to
+// use.
+type MemoryDeadLetters struct {
+	mu      sync.Mutex
+	letters []DeadLetter
+}
+
+func (m *MemoryDeadLetters) Put(ctx context.Context, dl DeadLetter) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.letters = append(m.letters, dl)
+	return nil
+}
+
+// Letters returns the dead letters received so far, oldest first.
+func (m *MemoryDeadLetters) Letters() []DeadLetter {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]DeadLetter(nil), m.letters...)
+}
+
+// FileDeadLetters appends dead letters to a file as JSON lines, read them back
+// with ReadDeadLetters.
+type FileDeadLetters struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+// deadLetterLine is a line of a dead letter file.
+type deadLetterLine struct {
+	Message *outboxMessage `json:"message"`
+	Chunk   int            `json:"chunk"`
+	Error   string         `json:"error"`
+	Time    time.Time      `json:"time"`
+}
+
+// OpenFileDeadLetters opens the dead letter file at path, created if missing.
+func OpenFileDeadLetters(path string) (*FileDeadLetters, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	return &FileDeadLetters{file: file}, nil
+}
+
+// Put appends dl to the file and syncs it to disk.
+func (f *FileDeadLetters) Put(ctx context.Context, dl DeadLetter) error {
+	line := deadLetterLine{Message: encodeOutboxMessage(dl.Message), Chunk: dl.Chunk, Time: dl.Time}
+	if dl.Err != nil {
+		line.Error = dl.Err.Error()
+	}
+	// Marshal would never fail since lines only hold messages.
+	b, _ := json.Marshal(line)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, err := f.file.Write(append(b, '\n')); err != nil {
+		return err
+	}
+	return f.file.Sync()
+}
+
+// Close closes the file.
+func (f *FileDeadLetters) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.file.Close()
+}
+
+// ReadDeadLetters reads dead letters written by FileDeadLetters, e.g. to send
+// their messages again once the cause of their rejection is fixed. Err of the
+// dead letters only holds the message of the original error.
+func ReadDeadLetters(r io.Reader) ([]DeadLetter, error) {
+	var letters []DeadLetter
+	scanner := bufio.NewScanner(r)
+	// Lines hold the content of files.
+	scanner.Buffer(nil, maxRecordSize)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var line deadLetterLine
+		if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+			return letters, err
+		}
+		if line.Message == nil {
+			return letters, errors.New("dead letter without message")
+		}
+		dl := DeadLetter{Message: line.Message.decode(), Chunk: line.Chunk, Time: line.Time}
+		if line.Error != "" {
+			dl.Err = errors.New(line.Error)
+		}
+		letters = append(letters, dl)
+	}
+	return letters, scanner.Err()
+}
@@ -0,0 +1,190 @@
+package messenger
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWithDeadLetters(t *testing.T) {
+	t.Run("Invalid message", func(t *testing.T) {
+		sink := &MemoryDeadLetters{}
+		c := &Client{client: http.DefaultClient}
+		// A template producing invalid messages.
+		WithMessageTemplate(Message{Flags: 1})(c)
+		WithDeadLetters(sink)(c)
+		msgs := []Message{{Content: "1"}, {Content: "2"}}
+
+		_, err := c.Send(msgs)
+
+		require.Error(t, err, "Invalid message failed")
+		letters := sink.Letters()
+		require.Len(t, letters, 1, "Invalid message failed")
+		require.Equal(t, msgs[0], letters[0].Message, "Invalid message failed")
+		require.Equal(t, 0, letters[0].Chunk, "Invalid message failed")
+		require.Equal(t, err.Error(), letters[0].Err.Error(), "Invalid message failed")
+		require.False(t, letters[0].Time.IsZero(), "Invalid message failed")
+	})
+
+	t.Run("Rejected chunk", func(t *testing.T) {
+		server := newTestServer(nil, http.StatusNoContent, http.StatusBadRequest)
+		defer server.Close()
+		sink := &MemoryDeadLetters{}
+		c := &Client{url: server.URL, client: http.DefaultClient}
+		WithEmbedTemplate(Embed{Footer: Footer{Text: "production"}})(c)
+		WithDeadLetters(sink)(c)
+		embeds := make([]Embed, MessageEmbedNumLimit+1)
+		for i := range embeds {
+			embeds[i] = Embed{Title: "embed"}
+		}
+		msg := Message{Embeds: embeds}
+
+		_, err := c.Send([]Message{msg})
+
+		var apiErr *APIError
+		require.ErrorAs(t, err, &apiErr, "Rejected chunk failed")
+		letters := sink.Letters()
+		require.Len(t, letters, 1, "Rejected chunk failed")
+		require.Equal(t, msg, letters[0].Message, "Rejected chunk failed")
+		require.Equal(t, 1, letters[0].Chunk, "Rejected chunk failed")
+		require.ErrorAs(t, letters[0].Err, &apiErr, "Rejected chunk failed")
+	})
+
+	t.Run("Resume", func(t *testing.T) {
+		server := newTestServer(nil, http.StatusNoContent, http.StatusBadRequest)
+		defer server.Close()
+		sink := &MemoryDeadLetters{}
+		c := &Client{url: server.URL, client: http.DefaultClient}
+		WithDeadLetters(sink)(c)
+		msgs := []Message{{Content: "1"}, {Content: "2"}}
+
+		_, err := c.Send(msgs[:1])
+		require.NoError(t, err, "Resume failed")
+		_, err = c.Resume(context.Background(), &PartialSendError{Index: 1, Pending: msgs[1:]})
+
+		require.Error(t, err, "Resume failed")
+		require.Equal(t, msgs[1], sink.Letters()[0].Message, "Resume failed")
+	})
+
+	t.Run("Retryable errors", func(t *testing.T) {
+		for _, status := range []int{http.StatusInternalServerError, http.StatusTooManyRequests} {
+			server := newTestServer(nil, status)
+			sink := &MemoryDeadLetters{}
+			c := &Client{url: server.URL, client: http.DefaultClient, maxAttempts: 1}
+			WithDeadLetters(sink)(c)
+
+			_, err := c.Send([]Message{{Content: "1"}})
+
+			server.Close()
+			require.Error(t, err, "Retryable errors failed")
+			require.Empty(t, sink.Letters(), "Retryable errors failed")
+		}
+	})
+
+	t.Run("Sink error", func(t *testing.T) {
+		c := &Client{client: http.DefaultClient}
+		WithDeadLetters(failingSink{})(c)
+
+		_, err := c.Send([]Message{{}})
+
+		require.EqualError(t, err, "Message must have either content or embeds")
+	})
+}
+
+type failingSink struct{}
+
+func (failingSink) Put(ctx context.Context, dl DeadLetter) error {
+	return errors.New("sink failed")
+}
+
+func TestFileDeadLetters(t *testing.T) {
+	t.Run("Round trip", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "dead.jsonl")
+		sink, err := OpenFileDeadLetters(path)
+		require.NoError(t, err, "Round trip failed")
+		now := time.Now().UTC().Truncate(time.Millisecond)
+		letters := []DeadLetter{
+			{Message: Message{Content: "1", ThreadID: "300"}, Chunk: 2, Err: errors.New("rejected"), Time: now},
+			{Message: Message{Content: "2", Files: []*File{{Name: "a.txt", ContentType: "text/plain", Reader: strings.NewReader("a")}}}, Time: now},
+		}
+		buffered, err := bufferFiles([]Message{letters[1].Message})
+		require.NoError(t, err, "Round trip failed")
+		letters[1].Message = buffered[0]
+
+		for _, dl := range letters {
+			require.NoError(t, sink.Put(context.Background(), dl), "Round trip failed")
+		}
+		require.NoError(t, sink.Close(), "Round trip failed")
+		file, err := os.Open(path)
+		require.NoError(t, err, "Round trip failed")
+		defer file.Close()
+		read, err := ReadDeadLetters(file)
+
+		require.NoError(t, err, "Round trip failed")
+		require.Len(t, read, 2, "Round trip failed")
+		require.Equal(t, letters[0].Message, read[0].Message, "Round trip failed")
+		require.Equal(t, 2, read[0].Chunk, "Round trip failed")
+		require.EqualError(t, read[0].Err, "rejected", "Round trip failed")
+		require.True(t, now.Equal(read[0].Time), "Round trip failed")
+		require.Nil(t, read[1].Err, "Round trip failed")
+		file2 := read[1].Message.Files[0]
+		data, _ := io.ReadAll(file2.Reader)
+		require.Equal(t, "a.txt", file2.Name, "Round trip failed")
+		require.Equal(t, "text/plain", file2.ContentType, "Round trip failed")
+		require.Equal(t, "a", string(data), "Round trip failed")
+	})
+
+	t.Run("Appends", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "dead.jsonl")
+		for _, content := range []string{"1", "2"} {
+			sink, err := OpenFileDeadLetters(path)
+			require.NoError(t, err, "Appends failed")
+			sink.Put(context.Background(), DeadLetter{Message: Message{Content: content}})
+			sink.Close()
+		}
+		file, _ := os.Open(path)
+		defer file.Close()
+
+		read, err := ReadDeadLetters(file)
+
+		require.NoError(t, err, "Appends failed")
+		require.Len(t, read, 2, "Appends failed")
+		require.Equal(t, "2", read[1].Message.Content, "Appends failed")
+	})
+
+	t.Run("Open error", func(t *testing.T) {
+		_, err := OpenFileDeadLetters(filepath.Join(t.TempDir(), "missing", "dead.jsonl"))
+
+		require.Error(t, err, "Open error failed")
+	})
+}
+
+func TestReadDeadLetters(t *testing.T) {
+	t.Run("Invalid JSON", func(t *testing.T) {
+		read, err := ReadDeadLetters(strings.NewReader(`{"message": {"content": "1"}}` + "\n" + `{"message":`))
+
+		require.Error(t, err, "Invalid JSON failed")
+		require.Len(t, read, 1, "Invalid JSON failed")
+	})
+
+	t.Run("Missing message", func(t *testing.T) {
+		_, err := ReadDeadLetters(strings.NewReader(`{"chunk": 1}`))
+
+		require.EqualError(t, err, "dead letter without message")
+	})
+
+	t.Run("Empty lines", func(t *testing.T) {
+		read, err := ReadDeadLetters(strings.NewReader("\n" + `{"message": {"content": "1"}}` + "\n\n"))
+
+		require.NoError(t, err, "Empty lines failed")
+		require.Len(t, read, 1, "Empty lines failed")
+	})
+}
@@ -0,0 +1,119 @@
+package messenger
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// DedupStore remembers the DedupKey of delivered messages, see
+// WithDedupStore. Reserve must be atomic, so that concurrent sends of the same
+// key deliver once.
+type DedupStore interface {
+	// Reserve claims key before a message with key is sent. It reports false
+	// when key is reserved or was delivered.
+	Reserve(ctx context.Context, key string) (bool, error)
+	// Release frees a key reserved by a send which failed.
+	Release(ctx context.Context, key string) error
+	// Mark records that a message with key was delivered.
+	Mark(ctx context.Context, key string) error
+}
+
+// WithDedupStore skips the messages whose DedupKey is in store, e.g. when a
+// job sending an alert is retried. A key is reserved before its message is
+// sent, marked once every message divided from it is delivered and released
+// when one fails. A message whose key is reserved by a send in progress is
+// skipped too, even if that send fails later. Messages without DedupKey are
+// always sent. When the store fails the message is sent.
+func WithDedupStore(store DedupStore) Option {
+	return func(c *Client) {
+		c.dedup = store
+	}
+}
+
+// reserve reserves the key of msg, the first message divided from its message.
+// duplicate reports whether the message was delivered or is being sent,
+// reserved whether the key is to be released if sending fails.
+func (c *Client) reserve(ctx context.Context, msg Message) (duplicate, reserved bool) {
+	if c.dedup == nil || msg.DedupKey == "" {
+		return false, false
+	}
+	ok, err := c.dedup.Reserve(ctx, msg.DedupKey)
+	if err != nil {
+		c.log(ctx, slog.LevelWarn, "reserving dedup key failed", "dedup_key", msg.DedupKey, "error", err)
+		return false, false
+	}
+	return !ok, ok
+}
+
+// release releases the key of msg, whose message failed. It runs even when
+// sending failed as ctx is done.
+func (c *Client) release(ctx context.Context, msg Message) {
+	if err := c.dedup.Release(context.WithoutCancel(ctx), msg.DedupKey); err != nil {
+		c.log(ctx, slog.LevelError, "releasing dedup key failed", "dedup_key", msg.DedupKey, "error", err)
+	}
+}
+
+// delivered marks the key of msg, the last message divided from its message.
+func (c *Client) delivered(ctx context.Context, msg Message) {
+	if c.dedup == nil || msg.DedupKey == "" {
+		return
+	}
+	if err := c.dedup.Mark(ctx, msg.DedupKey); err != nil {
+		c.log(ctx, slog.LevelError, "storing dedup key failed", "dedup_key", msg.DedupKey, "error", err)
+	}
+}
+
+// MemoryDedupStore keeps the keys of delivered messages in memory for a fixed
+// time. Reserved keys are kept for the same time, in case they are neither
+// marked nor released.
+type MemoryDedupStore struct {
+	ttl time.Duration
+
+	mu   sync.Mutex
+	keys map[string]time.Time // Expiry of the keys.
+}
+
+// NewMemoryDedupStore returns a MemoryDedupStore keeping keys for ttl.
+func NewMemoryDedupStore(ttl time.Duration) *MemoryDedupStore {
+	return &MemoryDedupStore{ttl: ttl, keys: make(map[string]time.Time)}
+}
+
+// Reserve records key unless it is kept already, expired keys are removed.
+func (s *MemoryDedupStore) Reserve(ctx context.Context, key string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.removeExpired()
+	if _, ok := s.keys[key]; ok {
+		return false, nil
+	}
+	s.keys[key] = time.Now().Add(s.ttl)
+	return true, nil
+}
+
+func (s *MemoryDedupStore) Release(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.keys, key)
+	return nil
+}
+
+// Mark records key, expired keys are removed.
+func (s *MemoryDedupStore) Mark(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.removeExpired()
+	s.keys[key] = time.Now().Add(s.ttl)
+	return nil
+}
+
+// removeExpired removes the expired keys. s.mu must be held.
+func (s *MemoryDedupStore) removeExpired() {
+	now := time.Now()
+	for k, expiry := range s.keys {
+		if !now.Before(expiry) {
+			delete(s.keys, k)
+		}
+	}
+}
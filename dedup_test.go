@@ -0,0 +1,193 @@
+package messenger
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWithDedupStore(t *testing.T) {
+	t.Run("Skipped", func(t *testing.T) {
+		server := newTestServer(nil)
+		defer server.Close()
+		c := &Client{url: server.URL, client: http.DefaultClient}
+		WithDedupStore(NewMemoryDedupStore(time.Minute))(c)
+		msgs := []Message{{Content: "1", DedupKey: "job-1"}, {Content: "2"}}
+
+		_, err := c.Send(msgs)
+		require.NoError(t, err, "Skipped failed")
+		results, err := c.Send(msgs)
+
+		require.NoError(t, err, "Skipped failed")
+		require.Equal(t, []string{"1", "2", "2"}, server.Contents(), "Skipped failed")
+		require.Len(t, results, 2, "Skipped failed")
+		require.True(t, results[0].Skipped, "Skipped failed")
+		require.Zero(t, results[0].StatusCode, "Skipped failed")
+		require.Equal(t, "1", results[0].Message.Content, "Skipped failed")
+		require.False(t, results[1].Skipped, "Skipped failed")
+	})
+
+	t.Run("Divided message", func(t *testing.T) {
+		server := newTestServer(nil)
+		defer server.Close()
+		c := &Client{url: server.URL, client: http.DefaultClient}
+		WithDedupStore(NewMemoryDedupStore(time.Minute))(c)
+		msg := Message{Content: "1", Embeds: make([]Embed, MessageEmbedNumLimit+1), DedupKey: "job-1"}
+		for i := range msg.Embeds {
+			msg.Embeds[i] = Embed{Title: "embed"}
+		}
+
+		c.Send([]Message{msg})
+		results, err := c.Send([]Message{msg})
+
+		require.NoError(t, err, "Divided message failed")
+		require.Equal(t, []string{"1", ""}, server.Contents(), "Divided message failed")
+		require.Len(t, results, 2, "Divided message failed")
+		require.True(t, results[0].Skipped, "Divided message failed")
+		require.True(t, results[1].Skipped, "Divided message failed")
+	})
+
+	t.Run("Partially delivered", func(t *testing.T) {
+		server := newTestServer(nil, http.StatusNoContent, http.StatusBadRequest)
+		defer server.Close()
+		store := NewMemoryDedupStore(time.Minute)
+		c := &Client{url: server.URL, client: http.DefaultClient}
+		WithDedupStore(store)(c)
+		msg := Message{Embeds: make([]Embed, MessageEmbedNumLimit+1), DedupKey: "job-1"}
+		for i := range msg.Embeds {
+			msg.Embeds[i] = Embed{Title: "embed"}
+		}
+
+		_, err := c.Send([]Message{msg})
+
+		require.Error(t, err, "Partially delivered failed")
+		reserved, _ := store.Reserve(context.Background(), "job-1")
+		require.True(t, reserved, "Partially delivered failed")
+	})
+
+	t.Run("Released on failure", func(t *testing.T) {
+		server := newTestServer(nil, http.StatusInternalServerError)
+		defer server.Close()
+		c := server.client()
+		WithDedupStore(NewMemoryDedupStore(time.Minute))(c)
+		msgs := []Message{{Content: "1", DedupKey: "job-1"}}
+
+		_, err := c.Send(msgs)
+		require.Error(t, err, "Released on failure failed")
+		results, err := c.Send(msgs)
+
+		require.NoError(t, err, "Released on failure failed")
+		require.False(t, results[0].Skipped, "Released on failure failed")
+		require.Equal(t, []string{"1"}, server.Contents(), "Released on failure failed")
+	})
+
+	t.Run("Concurrent", func(t *testing.T) {
+		release := make(chan struct{})
+		server := newTestServer(release)
+		defer server.Close()
+		c := &Client{url: server.URL, client: http.DefaultClient}
+		WithDedupStore(NewMemoryDedupStore(time.Minute))(c)
+		msgs := []Message{{Content: "1", DedupKey: "job-1"}}
+		done := make(chan error)
+		go func() {
+			_, err := c.Send(msgs)
+			done <- err
+		}()
+		<-server.received
+
+		// The first send holds the key until Discord responds.
+		results, err := c.Send(msgs)
+		close(release)
+
+		require.NoError(t, err, "Concurrent failed")
+		require.True(t, results[0].Skipped, "Concurrent failed")
+		require.NoError(t, <-done, "Concurrent failed")
+		require.Equal(t, []string{"1"}, server.Contents(), "Concurrent failed")
+	})
+
+	t.Run("Without store", func(t *testing.T) {
+		server := newTestServer(nil)
+		defer server.Close()
+		c := &Client{url: server.URL, client: http.DefaultClient}
+		msgs := []Message{{Content: "1", DedupKey: "job-1"}}
+
+		c.Send(msgs)
+		results, err := c.Send(msgs)
+
+		require.NoError(t, err, "Without store failed")
+		require.Equal(t, []string{"1", "1"}, server.Contents(), "Without store failed")
+		require.False(t, results[0].Skipped, "Without store failed")
+	})
+
+	t.Run("Store error", func(t *testing.T) {
+		server := newTestServer(nil)
+		defer server.Close()
+		c := &Client{url: server.URL, client: http.DefaultClient}
+		WithDedupStore(failingDedupStore{})(c)
+		msgs := []Message{{Content: "1", DedupKey: "job-1"}}
+
+		c.Send(msgs)
+		_, err := c.Send(msgs)
+
+		require.NoError(t, err, "Store error failed")
+		require.Equal(t, []string{"1", "1"}, server.Contents(), "Store error failed")
+	})
+}
+
+type failingDedupStore struct{}
+
+func (failingDedupStore) Reserve(ctx context.Context, key string) (bool, error) {
+	return false, errors.New("store failed")
+}
+
+func (failingDedupStore) Release(ctx context.Context, key string) error {
+	return errors.New("store failed")
+}
+
+func (failingDedupStore) Mark(ctx context.Context, key string) error {
+	return errors.New("store failed")
+}
+
+func TestMemoryDedupStore(t *testing.T) {
+	t.Run("Marked", func(t *testing.T) {
+		s := NewMemoryDedupStore(time.Minute)
+
+		s.Mark(context.Background(), "1")
+
+		reserved, err := s.Reserve(context.Background(), "1")
+		require.NoError(t, err, "Marked failed")
+		require.False(t, reserved, "Marked failed")
+		reserved, _ = s.Reserve(context.Background(), "2")
+		require.True(t, reserved, "Marked failed")
+	})
+
+	t.Run("Reserved", func(t *testing.T) {
+		s := NewMemoryDedupStore(time.Minute)
+
+		first, _ := s.Reserve(context.Background(), "1")
+		second, _ := s.Reserve(context.Background(), "1")
+		s.Release(context.Background(), "1")
+		third, _ := s.Reserve(context.Background(), "1")
+
+		require.True(t, first, "Reserved failed")
+		require.False(t, second, "Reserved failed")
+		require.True(t, third, "Reserved failed")
+	})
+
+	t.Run("Expired", func(t *testing.T) {
+		s := NewMemoryDedupStore(20 * time.Millisecond)
+		s.Mark(context.Background(), "1")
+
+		time.Sleep(30 * time.Millisecond)
+		s.Mark(context.Background(), "2")
+		keys := len(s.keys)
+		reserved, _ := s.Reserve(context.Background(), "1")
+
+		require.Equal(t, 1, keys, "Expired failed")
+		require.True(t, reserved, "Expired failed")
+	})
+}
@@ -0,0 +1,236 @@
+package messenger
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// DefaultQueueSize is the number of messages a Dispatcher holds by default.
+const DefaultQueueSize = 100
+
+// Errors returned by Dispatcher.Enqueue.
+var (
+	ErrQueueFull        = errors.New("dispatcher queue is full")
+	ErrDispatcherClosed = errors.New("dispatcher is closed")
+)
+
+// OverflowPolicy decides what Dispatcher.Enqueue does when the queue is full.
+type OverflowPolicy int
+
+const (
+	// OverflowBlock waits for room in the queue.
+	OverflowBlock OverflowPolicy = iota
+	// OverflowDropOldest drops the oldest queued message to make room.
+	OverflowDropOldest
+	// OverflowDropNewest drops the enqueued message, Enqueue returns
+	// ErrQueueFull.
+	OverflowDropNewest
+)
+
+// DispatcherOption configures a Dispatcher.
+type DispatcherOption func(*Dispatcher)
+
+// WithQueueSize sets the number of messages the queue holds. Values below 1
+// are treated as 1.
+func WithQueueSize(n int) DispatcherOption {
+	return func(d *Dispatcher) {
+		if n < 1 {
+			n = 1
+		}
+		d.size = n
+	}
+}
+
+// WithOverflow sets what happens to messages enqueued when the queue is full,
+// OverflowBlock by default.
+func WithOverflow(p OverflowPolicy) DispatcherOption {
+	return func(d *Dispatcher) {
+		d.overflow = p
+	}
+}
+
+// WithErrorHandler sets the function called with every message the
+// Dispatcher failed to deliver. It runs on the goroutine of the Dispatcher.
+func WithErrorHandler(f func(msg Message, err error)) DispatcherOption {
+	return func(d *Dispatcher) {
+		d.onError = f
+	}
+}
+
+// DispatcherStats counts the messages of a Dispatcher.
+type DispatcherStats struct {
+	// Queued is the number of messages waiting in the queue.
+	Queued int
+	Sent   uint64
+	Failed uint64
+	// Dropped is the number of messages dropped by the overflow policy.
+	Dropped uint64
+}
+
+// Dispatcher sends messages with a Client from a background goroutine, so that
+// callers do not wait for Discord or the rate limit. Messages are sent in the
+// order they are enqueued.
+type Dispatcher struct {
+	client   *Client
+	size     int
+	overflow OverflowPolicy
+	onError  func(msg Message, err error)
+
+	mu        sync.Mutex
+	queue     []Message
+	closed    bool
+	enqueued  uint64 // Messages accepted by Enqueue.
+	processed uint64 // Messages sent, failed or dropped after being accepted.
+	stats     DispatcherStats
+	changed   notifier
+
+	ctx    context.Context // Cancelled when Close gives up waiting.
+	cancel context.CancelFunc
+	done   chan struct{} // Closed when the worker returns.
+}
+
+// NewDispatcher starts a Dispatcher sending with c. It must be closed with
+// Close to deliver the queued messages and stop its goroutine.
+func NewDispatcher(c *Client, opts ...DispatcherOption) *Dispatcher {
+	d := &Dispatcher{
+		client: c,
+		size:   DefaultQueueSize,
+		done:   make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(d)
+	}
+	d.ctx, d.cancel = context.WithCancel(context.Background())
+	go d.run()
+	return d
+}
+
+// Enqueue queues msg for sending. msg is validated and its files are read
+// before Enqueue returns, so that errors of the message itself are returned
+// here. Enqueue only blocks with OverflowBlock while the queue is full.
+func (d *Dispatcher) Enqueue(msg Message) error {
+	if err := validateMessages(d.client.divide([]Message{msg})); err != nil {
+		return err
+	}
+	buffered, err := bufferFiles([]Message{msg})
+	if err != nil {
+		return err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for {
+		if d.closed {
+			return ErrDispatcherClosed
+		}
+		if len(d.queue) < d.size {
+			break
+		}
+		switch d.overflow {
+		case OverflowDropNewest:
+			d.stats.Dropped++
+			return ErrQueueFull
+		case OverflowDropOldest:
+			d.queue = d.queue[1:]
+			d.stats.Dropped++
+			d.processed++
+		default:
+			changed := d.changed.wait()
+			d.mu.Unlock()
+			<-changed
+			d.mu.Lock()
+		}
+	}
+	d.queue = append(d.queue, buffered[0])
+	d.enqueued++
+	d.changed.broadcast()
+	return nil
+}
+
+// Flush waits until the messages enqueued before the call are sent or failed.
+func (d *Dispatcher) Flush(ctx context.Context) error {
+	d.mu.Lock()
+	target := d.enqueued
+	for d.processed < target {
+		changed := d.changed.wait()
+		d.mu.Unlock()
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		d.mu.Lock()
+	}
+	d.mu.Unlock()
+	return nil
+}
+
+// Close stops accepting messages and waits for the queued ones to be sent.
+// When ctx is done first, the message being sent is cancelled, the rest fail
+// with the context error and ctx.Err() is returned.
+func (d *Dispatcher) Close(ctx context.Context) error {
+	d.mu.Lock()
+	if !d.closed {
+		d.closed = true
+		d.changed.broadcast()
+	}
+	d.mu.Unlock()
+
+	select {
+	case <-d.done:
+		return nil
+	case <-ctx.Done():
+		d.cancel()
+		<-d.done
+		return ctx.Err()
+	}
+}
+
+// Stats returns the counters of the Dispatcher.
+func (d *Dispatcher) Stats() DispatcherStats {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	stats := d.stats
+	stats.Queued = len(d.queue)
+	return stats
+}
+
+// run sends the queued messages until the Dispatcher is closed and the queue
+// is empty.
+func (d *Dispatcher) run() {
+	defer close(d.done)
+	defer d.cancel()
+	for {
+		d.mu.Lock()
+		for len(d.queue) == 0 && !d.closed {
+			changed := d.changed.wait()
+			d.mu.Unlock()
+			<-changed
+			d.mu.Lock()
+		}
+		if len(d.queue) == 0 {
+			d.mu.Unlock()
+			return
+		}
+		msg := d.queue[0]
+		d.queue = d.queue[1:]
+		d.changed.broadcast()
+		d.mu.Unlock()
+
+		_, err := d.client.SendContext(d.ctx, []Message{msg})
+
+		d.mu.Lock()
+		if err != nil {
+			d.stats.Failed++
+		} else {
+			d.stats.Sent++
+		}
+		d.processed++
+		d.changed.broadcast()
+		d.mu.Unlock()
+		if err != nil && d.onError != nil {
+			d.onError(msg, err)
+		}
+	}
+}
@@ -0,0 +1,211 @@
+package messenger
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDispatcher(t *testing.T) {
+	t.Run("In order", func(t *testing.T) {
+		server := newTestServer(nil)
+		defer server.Close()
+		d := NewDispatcher(server.client())
+
+		for _, content := range []string{"1", "2", "3"} {
+			require.NoError(t, d.Enqueue(Message{Content: content}), "In order failed")
+		}
+		err := d.Flush(context.Background())
+
+		require.NoError(t, err, "In order failed")
+		require.Equal(t, []string{"1", "2", "3"}, server.Contents(), "In order failed")
+		require.Equal(t, DispatcherStats{Sent: 3}, d.Stats(), "In order failed")
+		require.NoError(t, d.Close(context.Background()), "In order failed")
+	})
+
+	t.Run("Does not block", func(t *testing.T) {
+		release := make(chan struct{})
+		server := newTestServer(release)
+		defer server.Close()
+		d := NewDispatcher(server.client())
+		defer d.Close(context.Background())
+		defer close(release)
+
+		start := time.Now()
+		err := d.Enqueue(Message{Content: "1"})
+
+		require.NoError(t, err, "Does not block failed")
+		require.Less(t, time.Since(start), 50*time.Millisecond, "Does not block failed")
+	})
+
+	t.Run("Invalid message", func(t *testing.T) {
+		d := NewDispatcher(&Client{})
+		defer d.Close(context.Background())
+
+		err := d.Enqueue(Message{})
+
+		require.EqualError(t, err, "Message must have either content or embeds")
+		require.Equal(t, DispatcherStats{}, d.Stats(), "Invalid message failed")
+	})
+
+	t.Run("Closed", func(t *testing.T) {
+		server := newTestServer(nil)
+		defer server.Close()
+		d := NewDispatcher(server.client())
+		d.Enqueue(Message{Content: "1"})
+
+		require.NoError(t, d.Close(context.Background()), "Closed failed")
+		err := d.Enqueue(Message{Content: "2"})
+
+		require.ErrorIs(t, err, ErrDispatcherClosed, "Closed failed")
+		require.Equal(t, []string{"1"}, server.Contents(), "Closed failed")
+		require.NoError(t, d.Close(context.Background()), "Closed failed")
+	})
+
+	t.Run("Error handler", func(t *testing.T) {
+		server := newTestServer(nil, http.StatusNotFound)
+		defer server.Close()
+		var failed []Message
+		var errs []error
+		d := NewDispatcher(server.client(), WithErrorHandler(func(msg Message, err error) {
+			failed = append(failed, msg)
+			errs = append(errs, err)
+		}))
+
+		d.Enqueue(Message{Content: "1"})
+		d.Close(context.Background())
+
+		var apiErr *APIError
+		require.Equal(t, "1", failed[0].Content, "Error handler failed")
+		require.ErrorAs(t, errs[0], &apiErr, "Error handler failed")
+		require.Equal(t, DispatcherStats{Failed: 1}, d.Stats(), "Error handler failed")
+	})
+
+	t.Run("Close timeout", func(t *testing.T) {
+		release := make(chan struct{})
+		server := newTestServer(release)
+		defer server.Close()
+		defer close(release)
+		var errs []error
+		d := NewDispatcher(server.client(), WithErrorHandler(func(msg Message, err error) { errs = append(errs, err) }))
+		d.Enqueue(Message{Content: "1"})
+		d.Enqueue(Message{Content: "2"})
+		<-server.received
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+
+		err := d.Close(ctx)
+
+		require.ErrorIs(t, err, context.DeadlineExceeded, "Close timeout failed")
+		require.Equal(t, DispatcherStats{Failed: 2}, d.Stats(), "Close timeout failed")
+		require.Len(t, errs, 2, "Close timeout failed")
+		require.ErrorIs(t, errs[1], context.Canceled, "Close timeout failed")
+	})
+
+	t.Run("Flush timeout", func(t *testing.T) {
+		release := make(chan struct{})
+		server := newTestServer(release)
+		defer server.Close()
+		defer close(release)
+		d := NewDispatcher(server.client())
+		d.Enqueue(Message{Content: "1"})
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+
+		err := d.Flush(ctx)
+
+		require.ErrorIs(t, err, context.DeadlineExceeded, "Flush timeout failed")
+	})
+}
+
+func TestDispatcherOverflow(t *testing.T) {
+	t.Run("Drop newest", func(t *testing.T) {
+		release := make(chan struct{})
+		server := newTestServer(release)
+		defer server.Close()
+		d := NewDispatcher(server.client(), WithQueueSize(1), WithOverflow(OverflowDropNewest))
+		d.Enqueue(Message{Content: "1"})
+		<-server.received
+		d.Enqueue(Message{Content: "2"})
+
+		err := d.Enqueue(Message{Content: "3"})
+
+		require.ErrorIs(t, err, ErrQueueFull, "Drop newest failed")
+		require.Equal(t, DispatcherStats{Queued: 1, Dropped: 1}, d.Stats(), "Drop newest failed")
+		close(release)
+		d.Close(context.Background())
+		require.Equal(t, []string{"1", "2"}, server.Contents(), "Drop newest failed")
+	})
+
+	t.Run("Drop oldest", func(t *testing.T) {
+		release := make(chan struct{})
+		server := newTestServer(release)
+		defer server.Close()
+		d := NewDispatcher(server.client(), WithQueueSize(1), WithOverflow(OverflowDropOldest))
+		d.Enqueue(Message{Content: "1"})
+		<-server.received
+		d.Enqueue(Message{Content: "2"})
+
+		err := d.Enqueue(Message{Content: "3"})
+
+		require.NoError(t, err, "Drop oldest failed")
+		close(release)
+		require.NoError(t, d.Flush(context.Background()), "Drop oldest failed")
+		require.Equal(t, []string{"1", "3"}, server.Contents(), "Drop oldest failed")
+		require.Equal(t, DispatcherStats{Sent: 2, Dropped: 1}, d.Stats(), "Drop oldest failed")
+		d.Close(context.Background())
+	})
+
+	t.Run("Block", func(t *testing.T) {
+		release := make(chan struct{})
+		server := newTestServer(release)
+		defer server.Close()
+		d := NewDispatcher(server.client(), WithQueueSize(1))
+		d.Enqueue(Message{Content: "1"})
+		<-server.received
+		d.Enqueue(Message{Content: "2"})
+
+		enqueued := make(chan error)
+		go func() { enqueued <- d.Enqueue(Message{Content: "3"}) }()
+
+		select {
+		case <-enqueued:
+			t.Fatal("Block failed")
+		case <-time.After(20 * time.Millisecond):
+		}
+		close(release)
+		require.NoError(t, <-enqueued, "Block failed")
+		d.Close(context.Background())
+		require.Equal(t, []string{"1", "2", "3"}, server.Contents(), "Block failed")
+	})
+
+	t.Run("Block until closed", func(t *testing.T) {
+		release := make(chan struct{})
+		server := newTestServer(release)
+		defer server.Close()
+		defer close(release)
+		d := NewDispatcher(server.client(), WithQueueSize(1))
+		d.Enqueue(Message{Content: "1"})
+		<-server.received
+		d.Enqueue(Message{Content: "2"})
+		enqueued := make(chan error)
+		go func() { enqueued <- d.Enqueue(Message{Content: "3"}) }()
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+
+		d.Close(ctx)
+
+		require.ErrorIs(t, <-enqueued, ErrDispatcherClosed, "Block until closed failed")
+	})
+
+	t.Run("Queue size", func(t *testing.T) {
+		d := &Dispatcher{}
+
+		WithQueueSize(0)(d)
+
+		require.Equal(t, 1, d.size, "Queue size failed")
+	})
+}
@@ -0,0 +1,39 @@
+package messenger
+
+import (
+	"context"
+	"log/slog"
+)
+
+// Hooks are called around the delivery of each divided message, e.g. to collect
+// metrics. They run on the goroutine sending the messages so should not block.
+type Hooks struct {
+	// BeforeSend is called before msg is sent, ahead of rate limit waits.
+	BeforeSend func(ctx context.Context, msg Message)
+	// AfterSend is called with the result of a message and the error of its
+	// delivery. StatusCode of result is 0 when Discord did not respond.
+	AfterSend func(ctx context.Context, result SendResult, err error)
+}
+
+// WithHooks sets the hooks called around the delivery of each message.
+func WithHooks(h Hooks) Option {
+	return func(c *Client) {
+		c.hooks = h
+	}
+}
+
+// WithLogger logs deliveries at debug level and retries at info or warn level
+// to l. Nothing is logged when not set.
+func WithLogger(l *slog.Logger) Option {
+	return func(c *Client) {
+		c.logger = l
+	}
+}
+
+// log logs to the logger of the Client along with its redacted url.
+func (c *Client) log(ctx context.Context, level slog.Level, msg string, args ...interface{}) {
+	if c.logger == nil {
+		return
+	}
+	c.logger.Log(ctx, level, msg, append([]interface{}{"webhook", c}, args...)...)
+}
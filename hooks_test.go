@@ -0,0 +1,86 @@
+package messenger
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWithHooks(t *testing.T) {
+	t.Run("Called", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusNoContent)
+		}))
+		defer server.Close()
+		var before []Message
+		var after []SendResult
+		c := &Client{url: server.URL, client: http.DefaultClient}
+		WithHooks(Hooks{
+			BeforeSend: func(ctx context.Context, msg Message) { before = append(before, msg) },
+			AfterSend: func(ctx context.Context, result SendResult, err error) {
+				require.NoError(t, err, "Called failed")
+				after = append(after, result)
+			},
+		})(c)
+
+		results, err := c.Send([]Message{{Content: "1"}, {Content: "2"}})
+
+		require.NoError(t, err, "Called failed")
+		require.Equal(t, []Message{{Content: "1"}, {Content: "2"}}, before, "Called failed")
+		require.Equal(t, results, after, "Called failed")
+	})
+
+	t.Run("Error", func(t *testing.T) {
+		var hookErr error
+		c := closedClient()
+		WithHooks(Hooks{AfterSend: func(ctx context.Context, result SendResult, err error) { hookErr = err }})(c)
+
+		c.Send([]Message{{Content: "1"}})
+
+		require.Error(t, hookErr, "Error failed")
+		require.NotContains(t, hookErr.Error(), secretToken, "Error failed")
+	})
+}
+
+func TestWithLogger(t *testing.T) {
+	t.Run("Retries", func(t *testing.T) {
+		var count int
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			count++
+			switch count {
+			case 1:
+				w.WriteHeader(http.StatusTooManyRequests)
+				w.Write([]byte(`{"retry_after": 0.001}`))
+			case 2:
+				w.WriteHeader(http.StatusInternalServerError)
+			default:
+				w.WriteHeader(http.StatusNoContent)
+			}
+		}))
+		defer server.Close()
+		var buf bytes.Buffer
+		c := &Client{url: server.URL + "/" + secretToken, token: secretToken, client: http.DefaultClient, maxAttempts: 3, serverErrors: true, backoff: time.Millisecond}
+		WithLogger(slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug})))(c)
+
+		_, err := c.Send([]Message{{Content: "1"}})
+
+		require.NoError(t, err, "Retries failed")
+		require.Contains(t, buf.String(), `level=INFO msg="rate limited, retrying"`, "Retries failed")
+		require.Contains(t, buf.String(), `level=WARN msg="server error, retrying"`, "Retries failed")
+		require.Contains(t, buf.String(), `level=DEBUG msg="message sent"`, "Retries failed")
+		require.Contains(t, buf.String(), "webhook="+server.URL+"/"+redacted, "Retries failed")
+		require.NotContains(t, buf.String(), secretToken, "Retries failed")
+	})
+
+	t.Run("Not set", func(t *testing.T) {
+		c := &Client{}
+
+		require.NotPanics(t, func() { c.log(context.Background(), slog.LevelInfo, "test") }, "Not set failed")
+	})
+}
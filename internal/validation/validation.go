@@ -0,0 +1,7 @@
+// Package validation shares the message checks of package messenger with
+// package messengertest without making them part of the public API.
+package validation
+
+// Message checks a messenger.Message against the Discord API limits. It is set
+// by package messenger when it is initialised.
+var Message func(msg interface{}) error
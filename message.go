@@ -1,6 +1,12 @@
 package messenger
 
-import "io"
+import (
+	"bytes"
+	"io"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
 
 // Message represents a webhook message.
 type Message struct {
@@ -8,8 +14,62 @@ type Message struct {
 	Files    []*File `json:"-"`
 	Content  string  `json:"content,omitempty"`
 	Username string  `json:"username,omitempty"`
+	// AvatarURL overrides the default avatar of the webhook.
+	AvatarURL string `json:"avatar_url,omitempty"`
+	TTS       bool   `json:"tts,omitempty"`
+	// AllowedMentions restricts who is notified by the mentions in Content.
+	// Discord parses every mention, including @everyone, when it is nil.
+	AllowedMentions *AllowedMentions `json:"allowed_mentions,omitempty"`
+	Flags           MessageFlags     `json:"flags,omitempty"`
+	// ThreadID posts the message in an existing thread of the channel.
+	ThreadID string `json:"-"`
+	// ThreadName creates a post with the name in a forum channel. When the
+	// message is divided, the other messages follow in the created post.
+	ThreadName string `json:"thread_name,omitempty"`
+	// AppliedTags are the IDs of the forum tags applied to the created post.
+	AppliedTags []string `json:"applied_tags,omitempty"`
+	// DedupKey identifies the message across sends, see WithDedupStore. It is
+	// not sent to Discord.
+	DedupKey string `json:"-"`
+
+	part int // Position among the messages divided from the same message.
+}
+
+// AllowedMentionType is a type of mention parsed from message content.
+type AllowedMentionType string
+
+// Types of mention parsed from message content.
+const (
+	AllowedMentionRoles    AllowedMentionType = "roles"
+	AllowedMentionUsers    AllowedMentionType = "users"
+	AllowedMentionEveryone AllowedMentionType = "everyone"
+)
+
+// AllowedMentions represents the allowed mentions object in message object.
+// The zero value notifies no one.
+// https://discord.com/developers/docs/resources/channel#allowed-mentions-object
+type AllowedMentions struct {
+	// Parse lists the types of mention notifying everyone mentioned.
+	Parse []AllowedMentionType `json:"parse,omitempty"`
+	// Users and Roles list the IDs that may be notified, they cannot be used
+	// along with the same type in Parse.
+	Users       []string `json:"users,omitempty"`
+	Roles       []string `json:"roles,omitempty"`
+	RepliedUser bool     `json:"replied_user,omitempty"`
 }
 
+// MessageFlags is a bit set of message flags.
+type MessageFlags int
+
+// Message flags webhooks may set.
+const (
+	// FlagSuppressEmbeds hides the embeds generated from links in content.
+	FlagSuppressEmbeds MessageFlags = 1 << 2
+	// FlagSuppressNotifications posts the message without push and desktop
+	// notifications.
+	FlagSuppressNotifications MessageFlags = 1 << 12
+)
+
 // Embed represents an embed object in message object.
 type Embed struct {
 	Fields      []Field   `json:"fields,omitempty"`
@@ -25,6 +85,40 @@ type Embed struct {
 	Color       int       `json:"color,omitempty"`
 }
 
+// WebhookMessage represents the message object Discord creates for a webhook
+// message. It is only returned when the Client waits for messages, see WithWait.
+// https://discord.com/developers/docs/resources/channel#message-object
+type WebhookMessage struct {
+	ID              string       `json:"id"`
+	ChannelID       string       `json:"channel_id"`
+	WebhookID       string       `json:"webhook_id,omitempty"`
+	Author          User         `json:"author"`
+	Content         string       `json:"content"`
+	Embeds          []Embed      `json:"embeds"`
+	Attachments     []Attachment `json:"attachments"`
+	Timestamp       time.Time    `json:"timestamp"`
+	EditedTimestamp *time.Time   `json:"edited_timestamp"`
+}
+
+// User represents the user object of the author of a message. For webhook
+// messages it holds the webhook id and the username the message was sent with.
+type User struct {
+	ID       string `json:"id"`
+	Username string `json:"username"`
+	Avatar   string `json:"avatar,omitempty"`
+	Bot      bool   `json:"bot,omitempty"`
+}
+
+// Attachment represents a file attached to a message.
+type Attachment struct {
+	ID          string `json:"id"`
+	Filename    string `json:"filename"`
+	ContentType string `json:"content_type,omitempty"`
+	Size        int    `json:"size"`
+	URL         string `json:"url"`
+	ProxyURL    string `json:"proxy_url"`
+}
+
 type File struct {
 	// Name must include file extension (e.g. .jpg)
 	Name string
@@ -32,6 +126,36 @@ type File struct {
 	// https://discord.com/developers/docs/reference#image-data/
 	ContentType string
 	Reader      io.Reader
+	data        []byte // Content read from Reader, sent instead of it.
+}
+
+// bufferFiles returns a copy of msgs with the content of every file read into
+// memory, so that a message can be sent again after its request failed.
+func bufferFiles(msgs []Message) ([]Message, error) {
+	buffered := make([]Message, len(msgs))
+	for i, msg := range msgs {
+		if len(msg.Files) > 0 {
+			files := make([]*File, len(msg.Files))
+			for j, f := range msg.Files {
+				b, err := f.bytes()
+				if err != nil {
+					return nil, err
+				}
+				files[j] = &File{Name: f.Name, ContentType: f.ContentType, Reader: bytes.NewReader(b), data: b}
+			}
+			msg.Files = files
+		}
+		buffered[i] = msg
+	}
+	return buffered, nil
+}
+
+// bytes returns the content of f.
+func (f *File) bytes() ([]byte, error) {
+	if f.data != nil || f.Reader == nil {
+		return f.data, nil
+	}
+	return io.ReadAll(f.Reader)
 }
 
 // Timestamp represents the timestamp string in an embed object
@@ -90,21 +214,183 @@ type Field struct {
 func divideMessages(messages []Message) (msgs []Message) {
 	for _, msg := range messages {
 		dividedEmbeds := divideEmbeds(msg)
-		// Create message for every embed chunk.
+		// Create message for every embed chunk, carrying the settings of the
+		// original message.
 		for i, embeds := range dividedEmbeds {
+			m := msg
+			m.Embeds = embeds
+			m.part = i
 			// First message contains content from original message.
-			var content string
-			var files []*File
-			if i == 0 {
-				content = msg.Content
-				files = msg.Files
+			if i > 0 {
+				m.Content = ""
+				m.Files = nil
 			}
-			msgs = append(msgs, Message{Username: msg.Username, Embeds: embeds, Content: content, Files: files})
+			msgs = append(msgs, m)
+		}
+	}
+	return msgs
+}
+
+// divideContent breaks the content exceeding MessageContentLimit of divided
+// messages into messages posted before the rest of the message, renumbering
+// the messages divided from the same message.
+func divideContent(messages []Message) (msgs []Message) {
+	var shift int
+	for _, msg := range messages {
+		if msg.part == 0 {
+			shift = 0
+		}
+		chunks := splitContent(msg.Content, MessageContentLimit)
+		for i, chunk := range chunks[:len(chunks)-1] {
+			m := msg
+			m.Content = chunk
+			m.Embeds = nil
+			m.Files = nil
+			m.part = i
+			msgs = append(msgs, m)
+		}
+		shift += len(chunks) - 1
+		// Embeds and files follow the last chunk of content.
+		msg.Content = chunks[len(chunks)-1]
+		msg.part += shift
+		msgs = append(msgs, msg)
+	}
+	return msgs
+}
+
+const codeFence = "```"
+
+// splitContent splits content into chunks of at most limit bytes, at the last
+// newline, else the last space, else the last rune boundary fitting. Code
+// blocks open at the end of a chunk are closed and reopened in the next one.
+func splitContent(content string, limit int) []string {
+	return splitText(content, limit, cutContent)
+}
+
+// splitText splits text like splitContent, at the cuts returned by cut.
+func splitText(text string, limit int, cut func(s string, size int) (int, int)) (chunks []string) {
+	var fence string // Opening line of the code block open at the start of rest.
+	rest := text
+	for {
+		prefix := ""
+		if fence != "" {
+			prefix = fence + "\n"
+		}
+		if len(prefix)+len(rest) <= limit {
+			return append(chunks, prefix+rest)
+		}
+		// Leave room to close a code block.
+		size := limit - len(prefix) - len("\n"+codeFence)
+		i, skip := cut(rest, size)
+		chunk := rest[:i]
+		rest = rest[i+skip:]
+		next := openFence(chunk, fence)
+		if next != "" {
+			chunk += "\n" + codeFence
 		}
+		chunks = append(chunks, prefix+chunk)
+		fence = next
+		// Keep room for content when the opening line is long.
+		if len(fence) > limit/2 {
+			fence = codeFence
+		}
+	}
+}
+
+// cutContent returns where to cut s to fit size bytes, and the length of the
+// separator dropped at the cut.
+func cutContent(s string, size int) (cut, skip int) {
+	window := s[:size]
+	if i := strings.LastIndexByte(window, '\n'); i > 0 {
+		return i, 1
+	}
+	if i := strings.LastIndexByte(window, ' '); i > 0 {
+		return i, 1
+	}
+	cut = size
+	for cut > 0 && !utf8.RuneStart(s[cut]) {
+		cut--
+	}
+	return cut, 0
+}
+
+// cutParagraph cuts s like cutContent, preferring the last blank line.
+func cutParagraph(s string, size int) (cut, skip int) {
+	if i := strings.LastIndex(s[:size], "\n\n"); i > 0 {
+		return i, 2
+	}
+	return cutContent(s, size)
+}
+
+// openFence returns the opening line of the code block open at the end of
+// chunk, fence being the one open at its start.
+func openFence(chunk, fence string) string {
+	for _, line := range strings.Split(chunk, "\n") {
+		line = strings.TrimLeft(line, " ")
+		if !strings.HasPrefix(line, codeFence) {
+			continue
+		}
+		if fence != "" {
+			fence = ""
+		} else if !strings.Contains(line[len(codeFence):], codeFence) {
+			// Not a block opened and closed on the same line.
+			fence = line
+		}
+	}
+	return fence
+}
+
+// continuedTitle is the title of the embeds continuing a split embed.
+const continuedTitle = "(cont.)"
+
+// splitEmbeds splits the embeds of messages exceeding the description, field
+// number or total limits into continuation embeds.
+func splitEmbeds(messages []Message) []Message {
+	msgs := make([]Message, len(messages))
+	for i, msg := range messages {
+		var embeds []Embed
+		for _, e := range msg.Embeds {
+			embeds = append(embeds, splitEmbed(e)...)
+		}
+		msg.Embeds = embeds
+		msgs[i] = msg
 	}
 	return msgs
 }
 
+// splitEmbed splits e into embeds within the limits. The title, URL, author,
+// thumbnail and color stay on the first embed, the footer, timestamp, image and
+// video go to the last, the others are titled continuedTitle. The description
+// is split at blank lines, fields are kept whole.
+func splitEmbed(e Embed) []Embed {
+	if len(e.Description) <= EmbedDescriptionLimit && len(e.Fields) <= EmbedFieldNumLimit && countEmbed(e) <= EmbedTotalLimit {
+		return []Embed{e}
+	}
+	var embeds []Embed
+	embed := Embed{Title: e.Title, URL: e.URL, Author: e.Author, Thumbnail: e.Thumbnail, Color: e.Color}
+	next := func() {
+		embeds = append(embeds, embed)
+		embed = Embed{Title: continuedTitle}
+	}
+	for i, d := range splitText(e.Description, EmbedDescriptionLimit, cutParagraph) {
+		if i > 0 {
+			next()
+		}
+		embed.Description = d
+	}
+	for _, f := range e.Fields {
+		if len(embed.Fields) == EmbedFieldNumLimit || countEmbed(embed)+len(f.Name)+len(f.Value) > EmbedTotalLimit {
+			next()
+		}
+		embed.Fields = append(embed.Fields, f)
+	}
+	if countEmbed(embed)+len(e.Footer.Text) > EmbedTotalLimit {
+		next()
+	}
+	embed.Footer, embed.Timestamp, embed.Image, embed.Video = e.Footer, e.Timestamp, e.Image, e.Video
+	return append(embeds, embed)
+}
+
 func divideEmbeds(msg Message) (dividedEmbeds [][]Embed) {
 	var total int
 	var startIndex int
@@ -1,6 +1,7 @@
 package messenger
 
 import (
+	"encoding/json"
 	"strings"
 	"testing"
 
@@ -27,6 +28,269 @@ func TestDivideMessages(t *testing.T) {
 	})
 }
 
+func TestDivideMessagesSettings(t *testing.T) {
+	embeds := []Embed{
+		{Description: strings.Repeat("t", 4000)},
+		{Description: strings.Repeat("e", 4000)},
+	}
+	msg := Message{
+		Content:         "@everyone",
+		Embeds:          embeds,
+		Username:        "alert",
+		AvatarURL:       "https://example.com/a.png",
+		TTS:             true,
+		AllowedMentions: &AllowedMentions{},
+		Flags:           FlagSuppressNotifications,
+	}
+
+	dividedMsgs := divideMessages([]Message{msg})
+
+	require.Len(t, dividedMsgs, 2, "Divide messages settings failed")
+	for _, m := range dividedMsgs {
+		require.Equal(t, "alert", m.Username, "Divide messages settings failed")
+		require.Equal(t, "https://example.com/a.png", m.AvatarURL, "Divide messages settings failed")
+		require.True(t, m.TTS, "Divide messages settings failed")
+		require.Equal(t, &AllowedMentions{}, m.AllowedMentions, "Divide messages settings failed")
+		require.Equal(t, FlagSuppressNotifications, m.Flags, "Divide messages settings failed")
+	}
+	require.Equal(t, "", dividedMsgs[1].Content, "Divide messages settings failed")
+}
+
+func TestDivideContent(t *testing.T) {
+	embeds := []Embed{
+		{Description: strings.Repeat("t", 4000)},
+		{Description: strings.Repeat("e", 4000)},
+	}
+	files := []*File{{Name: "a.txt"}}
+	msgs := divideMessages([]Message{
+		{Content: strings.Repeat("a\n", MessageContentLimit), Embeds: embeds, Files: files, Username: "alert"},
+		{Content: "short"},
+	})
+
+	dividedMsgs := divideContent(msgs)
+
+	require.Len(t, dividedMsgs, 5, "Divide content failed")
+	for i, m := range dividedMsgs[:4] {
+		require.Equal(t, i, m.part, "Divide content failed")
+		require.Equal(t, "alert", m.Username, "Divide content failed")
+		require.LessOrEqual(t, len(m.Content), MessageContentLimit, "Divide content failed")
+	}
+	require.Empty(t, dividedMsgs[0].Embeds, "Divide content failed")
+	require.Empty(t, dividedMsgs[0].Files, "Divide content failed")
+	// Embeds and files follow the content.
+	require.Equal(t, embeds[:1], dividedMsgs[2].Embeds, "Divide content failed")
+	require.Equal(t, files, dividedMsgs[2].Files, "Divide content failed")
+	require.Equal(t, embeds[1:], dividedMsgs[3].Embeds, "Divide content failed")
+	require.Equal(t, strings.Repeat("a\n", MessageContentLimit), dividedMsgs[0].Content+"\n"+dividedMsgs[1].Content+"\n"+dividedMsgs[2].Content, "Divide content failed")
+	require.Equal(t, Message{Content: "short"}, dividedMsgs[4], "Divide content failed")
+}
+
+func TestSplitContent(t *testing.T) {
+	t.Run("Fits", func(t *testing.T) {
+		chunks := splitContent("line 1\nline 2", 20)
+
+		require.Equal(t, []string{"line 1\nline 2"}, chunks, "Fits failed")
+	})
+
+	t.Run("Newline", func(t *testing.T) {
+		chunks := splitContent("line 1 word\nline 2 word", 20)
+
+		require.Equal(t, []string{"line 1 word", "line 2 word"}, chunks, "Newline failed")
+	})
+
+	t.Run("Word", func(t *testing.T) {
+		chunks := splitContent("word1 word2 word3 word4 word5", 20)
+
+		require.Equal(t, []string{"word1 word2", "word3 word4 word5"}, chunks, "Word failed")
+	})
+
+	t.Run("Rune", func(t *testing.T) {
+		content := strings.Repeat("é", 20)
+
+		chunks := splitContent(content, 20)
+
+		require.Equal(t, []string{strings.Repeat("é", 8), strings.Repeat("é", 8), strings.Repeat("é", 4)}, chunks, "Rune failed")
+	})
+
+	t.Run("Code block", func(t *testing.T) {
+		content := "Trace:\n```go\n" + strings.Repeat("frame\n", 10) + "```\nDone"
+
+		chunks := splitContent(content, 30)
+
+		require.Equal(t, content, strings.ReplaceAll(strings.Join(chunks, "\n"), "\n```\n```go", ""), "Code block failed")
+		for _, c := range chunks {
+			require.LessOrEqual(t, len(c), 30, "Code block failed")
+			require.Equal(t, 0, strings.Count(c, "```")%2, "Code block failed")
+		}
+		require.True(t, strings.HasPrefix(chunks[1], "```go\n"), "Code block failed")
+	})
+
+	t.Run("Inline code block", func(t *testing.T) {
+		chunks := splitContent("```code``` text\nmore text", 20)
+
+		require.Equal(t, []string{"```code``` text", "more text"}, chunks, "Inline code block failed")
+	})
+
+	t.Run("Long opening line", func(t *testing.T) {
+		content := "```" + strings.Repeat("a", 15) + "\n" + strings.Repeat("code\n", 10) + "```"
+
+		chunks := splitContent(content, 30)
+
+		for _, c := range chunks {
+			require.LessOrEqual(t, len(c), 30, "Long opening line failed")
+		}
+		require.True(t, strings.HasPrefix(chunks[1], "```\n"), "Long opening line failed")
+	})
+}
+
+func TestSplitEmbed(t *testing.T) {
+	t.Run("Within limits", func(t *testing.T) {
+		e := Embed{Title: "t", Description: "d", Fields: []Field{{Name: "n", Value: "v"}}}
+
+		embeds := splitEmbed(e)
+
+		require.Equal(t, []Embed{e}, embeds, "Within limits failed")
+	})
+
+	t.Run("Fields", func(t *testing.T) {
+		e := Embed{
+			Title:  "Report",
+			Author: Author{Name: "CI"},
+			Color:  0xe74c3c,
+			Footer: Footer{Text: "production"},
+			Image:  Image{URL: "https://example.com/a.png"},
+		}
+		for i := 0; i < 60; i++ {
+			e.Fields = append(e.Fields, Field{Name: "name", Value: "value"})
+		}
+
+		embeds := splitEmbed(e)
+
+		require.Len(t, embeds, 3, "Fields failed")
+		require.Len(t, embeds[0].Fields, EmbedFieldNumLimit, "Fields failed")
+		require.Len(t, embeds[1].Fields, EmbedFieldNumLimit, "Fields failed")
+		require.Len(t, embeds[2].Fields, 10, "Fields failed")
+		require.Equal(t, "Report", embeds[0].Title, "Fields failed")
+		require.Equal(t, Author{Name: "CI"}, embeds[0].Author, "Fields failed")
+		require.Equal(t, 0xe74c3c, embeds[0].Color, "Fields failed")
+		require.Equal(t, Footer{}, embeds[0].Footer, "Fields failed")
+		for _, c := range embeds[1:] {
+			require.Equal(t, "(cont.)", c.Title, "Fields failed")
+			require.Equal(t, Author{}, c.Author, "Fields failed")
+			require.Zero(t, c.Color, "Fields failed")
+		}
+		require.Equal(t, Footer{Text: "production"}, embeds[2].Footer, "Fields failed")
+		require.Equal(t, e.Image, embeds[2].Image, "Fields failed")
+	})
+
+	t.Run("Description", func(t *testing.T) {
+		paragraph := strings.Repeat("a", 1000)
+		e := Embed{Title: "Log", Description: strings.Repeat(paragraph+"\n\n", 5) + "end"}
+
+		embeds := splitEmbed(e)
+
+		require.Len(t, embeds, 2, "Description failed")
+		require.Equal(t, strings.Repeat(paragraph+"\n\n", 3)+paragraph, embeds[0].Description, "Description failed")
+		require.Equal(t, paragraph+"\n\nend", embeds[1].Description, "Description failed")
+		require.Equal(t, "(cont.)", embeds[1].Title, "Description failed")
+	})
+
+	t.Run("Total", func(t *testing.T) {
+		e := Embed{Description: strings.Repeat("d", EmbedDescriptionLimit)}
+		for i := 0; i < 3; i++ {
+			e.Fields = append(e.Fields, Field{Name: "name", Value: strings.Repeat("v", FieldValueLimit)})
+		}
+
+		embeds := splitEmbed(e)
+
+		require.Len(t, embeds, 2, "Total failed")
+		require.Len(t, embeds[0].Fields, 1, "Total failed")
+		for _, c := range embeds {
+			require.NoError(t, validateEmbed(c), "Total failed")
+		}
+	})
+}
+
+func TestSplitEmbeds(t *testing.T) {
+	fields := make([]Field, 30)
+	for i := range fields {
+		fields[i] = Field{Name: "name", Value: "value"}
+	}
+	msgs := []Message{{Content: "1", Embeds: []Embed{{Title: "a"}, {Title: "b", Fields: fields}}}}
+
+	splitMsgs := splitEmbeds(msgs)
+
+	require.Len(t, splitMsgs[0].Embeds, 3, "Split embeds failed")
+	require.Equal(t, "1", splitMsgs[0].Content, "Split embeds failed")
+	require.Len(t, msgs[0].Embeds[1].Fields, 30, "Split embeds failed")
+}
+
+func TestMessageJSON(t *testing.T) {
+	msg := Message{
+		Content:         "@everyone",
+		AllowedMentions: &AllowedMentions{},
+		Flags:           FlagSuppressEmbeds | FlagSuppressNotifications,
+		ThreadID:        "1",
+	}
+
+	b, err := json.Marshal(msg)
+
+	require.NoError(t, err, "Message JSON failed")
+	require.JSONEq(t, `{"content": "@everyone", "allowed_mentions": {}, "flags": 4100}`, string(b), "Message JSON failed")
+}
+
+func TestDivideMessagesThread(t *testing.T) {
+	embeds := []Embed{
+		{Description: strings.Repeat("t", 4000)},
+		{Description: strings.Repeat("e", 4000)},
+	}
+	msgs := []Message{
+		{Content: "1", Embeds: embeds, ThreadName: "post", AppliedTags: []string{"5"}},
+		{Content: "2", ThreadID: "99"},
+	}
+
+	dividedMsgs := divideMessages(msgs)
+
+	require.Len(t, dividedMsgs, 3, "Divide messages thread failed")
+	for i, part := range []int{0, 1} {
+		require.Equal(t, "post", dividedMsgs[i].ThreadName, "Divide messages thread failed")
+		require.Equal(t, []string{"5"}, dividedMsgs[i].AppliedTags, "Divide messages thread failed")
+		require.Equal(t, part, dividedMsgs[i].part, "Divide messages thread failed")
+	}
+	require.Equal(t, "99", dividedMsgs[2].ThreadID, "Divide messages thread failed")
+	require.Equal(t, 0, dividedMsgs[2].part, "Divide messages thread failed")
+}
+
+func TestBufferFiles(t *testing.T) {
+	t.Run("Read error", func(t *testing.T) {
+		msgs := []Message{{Files: []*File{{Name: "a.txt", Reader: readerMock{}}}}}
+
+		_, err := bufferFiles(msgs)
+
+		require.EqualError(t, err, "Test", "Read error failed")
+	})
+
+	t.Run("Content kept", func(t *testing.T) {
+		original := &File{Name: "a.txt", ContentType: "text/plain", Reader: strings.NewReader("test")}
+		msgs := []Message{{Content: "Ok"}, {Files: []*File{original}}}
+
+		buffered, err := bufferFiles(msgs)
+
+		require.NoError(t, err, "Content kept failed")
+		require.Equal(t, msgs[0], buffered[0], "Content kept failed")
+		f := buffered[1].Files[0]
+		require.NotSame(t, original, f, "Content kept failed")
+		require.Equal(t, "a.txt", f.Name, "Content kept failed")
+		require.Equal(t, "text/plain", f.ContentType, "Content kept failed")
+		require.Equal(t, []byte("test"), f.data, "Content kept failed")
+		require.Nil(t, original.data, "Content kept failed")
+
+		again, err := bufferFiles(buffered)
+		require.NoError(t, err, "Content kept failed")
+		require.Equal(t, []byte("test"), again[1].Files[0].data, "Content kept failed")
+	})
+}
+
 func TestDivideEmbeds(t *testing.T) {
 	t.Run("Divide by embed character limit", func(t *testing.T) {
 		expectedNumber := 3 //1000 + 2000 + 3000, 3000, 4000 + 2000
@@ -2,14 +2,18 @@ package messenger
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"log/slog"
 	"mime/multipart"
 	"net/http"
 	"net/textproto"
+	"net/url"
 	"strings"
+	"time"
 )
 
 // HttpClient represent standard library http compatible clients.
@@ -18,56 +22,669 @@ type HttpClient interface {
 }
 
 type Client struct {
-	url    string // Discord webhook url
-	client HttpClient
+	url          string // Discord webhook url
+	token        string // Webhook token, redacted from errors.
+	client       HttpClient
+	maxAttempts  int // Attempts per message when Discord responds 429.
+	serverErrors bool
+	backoff      time.Duration
+	limiter      RateLimiter
+	wait         bool   // Ask Discord to return the created messages.
+	baseURL      string // API base url replacing https://discord.com/api.
+	userAgent    string
+	defaults     Message // Template merged into every message, see WithMessageTemplate.
+	embed        Embed   // Template merged into every embed, see WithEmbedTemplate.
+	logger       *slog.Logger
+	hooks        Hooks
+	deadLetters  DeadLetterSink
+	dedup        DedupStore
+	splitContent bool // Split Content exceeding the limit, see WithSplitContent.
+	splitEmbeds  bool // Split embeds exceeding the limits, see WithSplitEmbeds.
 }
 
-// NewClient create a Client with valid formatted webhook url.
-func NewClient(hc HttpClient, url string) (*Client, error) {
-	if err := validateURL(url); err != nil {
+// DefaultMaxAttempts is the number of attempts made for each message when
+// Discord keeps responding 429 Too Many Requests.
+const DefaultMaxAttempts = 3
+
+// DefaultBackoff is the wait before the first retry of a server error, see
+// RetryPolicy.
+const DefaultBackoff = time.Second
+
+// Option configures a Client.
+type Option func(*Client)
+
+// WithMaxAttempts sets the number of attempts made for each message when
+// Discord responds 429 Too Many Requests. Values below 1 are treated as 1.
+func WithMaxAttempts(n int) Option {
+	return func(c *Client) {
+		if n < 1 {
+			n = 1
+		}
+		c.maxAttempts = n
+	}
+}
+
+// RetryPolicy controls how many times a message is sent and on which failures.
+// Responses 429 Too Many Requests are always retried after the wait Discord
+// asks for.
+type RetryPolicy struct {
+	// MaxAttempts is the number of attempts per message, including the first.
+	// Values below 1 are treated as 1.
+	MaxAttempts int
+	// ServerErrors also retries 5xx responses and failed connections. Such a
+	// message may have been posted anyway, so it can appear twice.
+	ServerErrors bool
+	// Backoff is the wait before retrying a server error, doubled after each
+	// attempt. DefaultBackoff is used when it is 0.
+	Backoff time.Duration
+}
+
+// WithRetryPolicy sets the retry policy of every message.
+func WithRetryPolicy(p RetryPolicy) Option {
+	return func(c *Client) {
+		WithMaxAttempts(p.MaxAttempts)(c)
+		c.serverErrors = p.ServerErrors
+		c.backoff = p.Backoff
+	}
+}
+
+// WithHTTPClient sets the client requests are sent with, http.DefaultClient
+// when not set.
+func WithHTTPClient(hc HttpClient) Option {
+	return func(c *Client) {
+		if hc != nil {
+			c.client = hc
+		}
+	}
+}
+
+// WithUserAgent sets the User-Agent header of every request.
+func WithUserAgent(userAgent string) Option {
+	return func(c *Client) {
+		c.userAgent = userAgent
+	}
+}
+
+// WithUsername sets the username of messages not setting one, overriding the
+// default username of the webhook.
+func WithUsername(username string) Option {
+	return func(c *Client) {
+		c.defaults.Username = username
+	}
+}
+
+// WithAvatarURL sets the avatar of messages not setting one, overriding the
+// default avatar of the webhook.
+func WithAvatarURL(avatarURL string) Option {
+	return func(c *Client) {
+		c.defaults.AvatarURL = avatarURL
+	}
+}
+
+// WithAllowedMentions sets the allowed mentions of messages not setting them,
+// e.g. AllowedMentions{} so that no message notifies anyone unless it says so.
+func WithAllowedMentions(a AllowedMentions) Option {
+	return func(c *Client) {
+		c.defaults.AllowedMentions = &a
+	}
+}
+
+// WithWait makes Discord wait for each message to be created and return it,
+// see SendResult.WebhookMessage.
+func WithWait(wait bool) Option {
+	return func(c *Client) {
+		c.wait = wait
+	}
+}
+
+// WithSplitContent makes Content exceeding MessageContentLimit be sent in
+// several messages instead of failing validation. Content is split at newlines,
+// else at spaces, else between runes, code blocks are closed at the end of a
+// message and reopened in the next.
+func WithSplitContent(split bool) Option {
+	return func(c *Client) {
+		c.splitContent = split
+	}
+}
+
+// WithSplitEmbeds makes embeds with more than EmbedFieldNumLimit fields, a
+// description exceeding EmbedDescriptionLimit or a total exceeding
+// EmbedTotalLimit be sent as several embeds instead of failing validation. The
+// embeds after the first are titled "(cont.)" and divided into messages like
+// other embeds.
+func WithSplitEmbeds(split bool) Option {
+	return func(c *Client) {
+		c.splitEmbeds = split
+	}
+}
+
+// WithBaseURL sends requests to baseURL instead of https://discord.com/api,
+// e.g. to a local fake of Discord in tests or to an egress proxy. Webhook urls
+// under baseURL are accepted by NewClient, as well as Discord webhook urls
+// which are rewritten onto baseURL.
+func WithBaseURL(baseURL string) Option {
+	return func(c *Client) {
+		c.baseURL = baseURL
+	}
+}
+
+// New creates a Client with valid formatted webhook url, see ParseWebhookURL
+// for the accepted formats. Requests are sent with http.DefaultClient unless
+// WithHTTPClient is given.
+func New(url string, opts ...Option) (*Client, error) {
+	c := newClient(opts)
+	base, err := parseBaseURL(c.baseURL)
+	if err != nil {
+		return nil, err
+	}
+	w, err := parseWebhookURL(url, base)
+	if err != nil {
 		return nil, err
 	}
-	return &Client{url: url, client: hc}, nil
+	c.setWebhook(w, base)
+	return c, nil
+}
+
+// NewClient create a Client with valid formatted webhook url sending requests
+// with hc, see New.
+func NewClient(hc HttpClient, url string, opts ...Option) (*Client, error) {
+	return New(url, append([]Option{WithHTTPClient(hc)}, opts...)...)
+}
+
+// NewClientFromWebhook create a Client for the webhook, e.g. built from its id
+// and token with NewWebhookURL.
+func NewClientFromWebhook(hc HttpClient, w WebhookURL, opts ...Option) (*Client, error) {
+	if err := w.validate(); err != nil {
+		return nil, err
+	}
+	c := newClient(append([]Option{WithHTTPClient(hc)}, opts...))
+	base, err := parseBaseURL(c.baseURL)
+	if err != nil {
+		return nil, err
+	}
+	c.setWebhook(w, base)
+	return c, nil
+}
+
+func newClient(opts []Option) *Client {
+	c := &Client{
+		client:      http.DefaultClient,
+		maxAttempts: DefaultMaxAttempts,
+		limiter:     &HeaderRateLimiter{},
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// setWebhook points the Client at w, under base when it is not nil.
+func (c *Client) setWebhook(w WebhookURL, base *url.URL) {
+	c.url, c.token = w.URL(), w.Token
+	if base != nil {
+		c.url = w.urlOn(base)
+	}
+}
+
+// SendResult describes the delivery of one divided message.
+type SendResult struct {
+	// Message is the message as sent after being divided.
+	Message    Message
+	StatusCode int
+	// RateLimit is the rate limit state reported with the response.
+	RateLimit RateLimit
+	// WebhookMessage is the message created by Discord, nil when the response
+	// does not contain it.
+	WebhookMessage *WebhookMessage
+	// Attempts is the number of requests made, including those answered with 429.
+	Attempts int
+	// RetryWait is the total time spent waiting before retries.
+	RetryWait time.Duration
+	// Skipped is true when the message was not sent since a message with the
+	// same DedupKey was delivered before, see WithDedupStore.
+	Skipped bool
 }
 
 // Send request to Discord webhook url via http post. Adjusted to the dynamic rate limit
-func (c *Client) Send(messages []Message) ([]*http.Response, error) {
-	dividedMessages := divideMessages(messages)
-	if err := validateMessages(dividedMessages); err != nil {
+func (c *Client) Send(messages []Message) ([]SendResult, error) {
+	return c.SendContext(context.Background(), messages)
+}
+
+// SendContext is like Send but carries ctx through every request and rate limit
+// wait. When ctx is cancelled or its deadline passes, the results of the
+// messages already delivered are returned along with the context error.
+func (c *Client) SendContext(ctx context.Context, messages []Message) (_ []SendResult, err error) {
+	defer func() { err = c.redactError(err) }()
+	// Files are read before dividing, so that dead letters hold the original
+	// message along with the file content.
+	messages, err = bufferFiles(messages)
+	if err != nil {
+		return nil, err
+	}
+	var dividedMessages []Message
+	var origins []*Message
+	for i := range messages {
+		for _, m := range c.divide(messages[i : i+1]) {
+			dividedMessages = append(dividedMessages, m)
+			origins = append(origins, &messages[i])
+		}
+	}
+	if err := c.validateDivided(ctx, dividedMessages, origins); err != nil {
+		return nil, err
+	}
+	return c.deliver(ctx, dividedMessages, origins, 0, nil)
+}
+
+// validateDivided validates divided messages, the first invalid one is put
+// into the dead letter sink.
+func (c *Client) validateDivided(ctx context.Context, msgs []Message, origins []*Message) error {
+	err := validateMessages(msgs)
+	if err != nil {
+		for i, m := range msgs {
+			if validateMessage(m) != nil {
+				c.putDeadLetter(ctx, m, origins[i], err)
+				break
+			}
+		}
+	}
+	return err
+}
+
+// divide merges the templates into messages and divides them to fit the
+// limits of Discord.
+func (c *Client) divide(messages []Message) []Message {
+	msgs := c.applyDefaults(messages)
+	if c.splitEmbeds {
+		msgs = splitEmbeds(msgs)
+	}
+	msgs = divideMessages(msgs)
+	if c.splitContent {
+		msgs = divideContent(msgs)
+	}
+	return msgs
+}
+
+// PartialSendError is returned when sending stops at one of the divided
+// messages. The messages before it have been posted to the channel, pass the
+// error to Client.Resume to send the rest without duplicating them.
+type PartialSendError struct {
+	// Index is the position of the first pending message among the divided
+	// messages: the failed one, or the one after it when Delivered.
+	Index int
+	// Delivered reports whether the failed message was delivered and the
+	// error came after, e.g. reading its response.
+	Delivered bool
+	// Results of the messages delivered before Index.
+	Results []SendResult
+	// Pending holds the messages left to send, from Index.
+	Pending []Message
+	Err     error
+
+	origins []*Message // Messages passed to Send, one per pending message.
+}
+
+func (e *PartialSendError) Error() string {
+	if e.Delivered {
+		return fmt.Sprintf("message %d was delivered but handling its response failed after %d delivered: %v", e.Index-1, len(e.Results), e.Err)
+	}
+	return fmt.Sprintf("sending message %d failed after %d delivered: %v", e.Index, len(e.Results), e.Err)
+}
+
+func (e *PartialSendError) Unwrap() error {
+	return e.Err
+}
+
+// Resume sends the messages left pending by err. The returned results include
+// the ones of err, so that they cover the whole batch.
+func (c *Client) Resume(ctx context.Context, err *PartialSendError) ([]SendResult, error) {
+	results := append([]SendResult(nil), err.Results...)
+	results, deliverErr := c.deliver(ctx, err.Pending, err.origins, err.Index, results)
+	return results, c.redactError(deliverErr)
+}
+
+// resumeFrom returns the PartialSendError left by sending msg once the first
+// sent messages divided from it were delivered, in the post created as threadID
+// when not empty. It lets an Outbox resume msg after a restart.
+func (c *Client) resumeFrom(ctx context.Context, msg Message, sent int, threadID string) (*PartialSendError, error) {
+	divided := c.divide([]Message{msg})
+	origins := make([]*Message, len(divided))
+	for i := range origins {
+		origins[i] = &msg
+	}
+	if err := c.validateDivided(ctx, divided, origins); err != nil {
 		return nil, err
 	}
+	if sent > len(divided) {
+		sent = len(divided)
+	}
+	pending := divided[sent:]
+	if threadID != "" {
+		followThread(pending, threadID)
+	}
+	return &PartialSendError{Index: sent, Pending: pending, origins: origins[sent:]}, nil
+}
 
-	var responses []*http.Response
-	for _, msg := range dividedMessages {
-		resp, err := makeRequest(msg, c.url, c.client)
+// deliver sends divided messages in order, appending to results. index is the
+// position of msgs[0] in the batch, origins holds the message each of msgs was
+// divided from, nil when unknown.
+func (c *Client) deliver(ctx context.Context, msgs []Message, origins []*Message, index int, results []SendResult) ([]SendResult, error) {
+	// reserved is whether the key of the message being sent is to be released
+	// on failure.
+	var skip, reserved bool
+	for i, msg := range msgs {
+		if err := ctx.Err(); err != nil {
+			if reserved {
+				c.release(ctx, msg)
+			}
+			return results, &PartialSendError{Index: index + i, Results: results, Pending: msgs[i:], Err: err, origins: tail(origins, i)}
+		}
+		// Duplicates are skipped along with every message divided from them.
+		if msg.part == 0 {
+			skip, reserved = c.reserve(ctx, msg)
+		}
+		if skip {
+			c.log(ctx, slog.LevelDebug, "duplicate message skipped", "index", index+i, "dedup_key", msg.DedupKey)
+			results = append(results, SendResult{Message: msg, Skipped: true})
+			continue
+		}
+
+		if c.hooks.BeforeSend != nil {
+			c.hooks.BeforeSend(ctx, msg)
+		}
+		result, err := c.send(ctx, msg)
+		if c.hooks.AfterSend != nil {
+			c.hooks.AfterSend(ctx, result, c.redactError(err))
+		}
+		if result.StatusCode != 0 {
+			c.log(ctx, slog.LevelDebug, "message sent", "index", index+i, "status", result.StatusCode, "attempts", result.Attempts)
+			results = append(results, result)
+			if msg.ThreadName != "" && result.WebhookMessage != nil {
+				followThread(msgs[i+1:], result.WebhookMessage.ChannelID)
+			}
+			if i+1 == len(msgs) || msgs[i+1].part == 0 {
+				c.delivered(ctx, msg)
+				reserved = false
+			}
+		}
+		if err == nil {
+			continue
+		}
+		if reserved {
+			c.release(ctx, msg)
+		}
+		if rejected(err) {
+			var origin *Message
+			if i < len(origins) {
+				origin = origins[i]
+			}
+			c.putDeadLetter(ctx, msg, origin, err)
+		}
+		failed := i
+		delivered := result.StatusCode != 0
+		if delivered {
+			failed++
+		}
+		return results, &PartialSendError{Index: index + failed, Delivered: delivered, Results: results, Pending: msgs[failed:], Err: err, origins: tail(origins, failed)}
+	}
+	return results, nil
+}
+
+// tail returns origins from i, nil when origins are unknown.
+func tail(origins []*Message, i int) []*Message {
+	if i >= len(origins) {
+		return nil
+	}
+	return origins[i:]
+}
+
+// followThread makes the messages divided from the same message as the one
+// that created a forum post follow it in the post.
+func followThread(msgs []Message, threadID string) {
+	for i := 0; i < len(msgs) && msgs[i].part > 0; i++ {
+		msgs[i].ThreadID = threadID
+		msgs[i].ThreadName = ""
+		msgs[i].AppliedTags = nil
+	}
+}
+
+// send posts msg. The StatusCode of the result is set once Discord accepted
+// the message, even if an error is returned.
+func (c *Client) send(ctx context.Context, msg Message) (SendResult, error) {
+	result := SendResult{Message: msg}
+	// The id of a created post is only known from the created message.
+	wait := c.wait || msg.ThreadName != ""
+	u, err := executeURL(c.url, wait, msg.ThreadID)
+	if err != nil {
+		return result, err
+	}
+	req, err := makeRequest(ctx, http.MethodPost, u, msg)
+	if err != nil {
+		return result, err
+	}
+	var created WebhookMessage
+	err = c.do(req, &result, &created)
+	// Only present when Discord is asked to wait for the message creation.
+	if created.ID != "" {
+		result.WebhookMessage = &created
+	}
+	return result, err
+}
+
+// EditMessage edits a message previously sent by the webhook and returns it as
+// edited. The templates of the Client are merged into msg like into the
+// messages passed to Send, except the username and avatar which cannot be
+// edited. msg is validated like them too, but it is not divided so it must fit
+// in one message.
+func (c *Client) EditMessage(ctx context.Context, messageID string, msg Message) (_ *WebhookMessage, err error) {
+	defer func() { err = c.redactError(err) }()
+	msg = c.mergeEditable(msg)
+	if err := validateMessage(msg); err != nil {
+		return nil, err
+	}
+	u, err := c.messageURL(messageID)
+	if err != nil {
+		return nil, err
+	}
+	if u, err = executeURL(u, false, msg.ThreadID); err != nil {
+		return nil, err
+	}
+	req, err := makeRequest(ctx, http.MethodPatch, u, msg)
+	if err != nil {
+		return nil, err
+	}
+	var edited WebhookMessage
+	if err := c.do(req, &SendResult{Message: msg}, &edited); err != nil {
+		return nil, err
+	}
+	return &edited, nil
+}
+
+// DeleteMessage deletes a message previously sent by the webhook.
+func (c *Client) DeleteMessage(ctx context.Context, messageID string) error {
+	return c.DeleteThreadMessage(ctx, "", messageID)
+}
+
+// DeleteThreadMessage deletes a message previously sent by the webhook in the
+// thread or forum post threadID, the channel when empty.
+func (c *Client) DeleteThreadMessage(ctx context.Context, threadID, messageID string) (err error) {
+	defer func() { err = c.redactError(err) }()
+	u, err := c.messageURL(messageID)
+	if err != nil {
+		return err
+	}
+	if u, err = executeURL(u, false, threadID); err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, u, nil)
+	if err != nil {
+		return err
+	}
+	return c.do(req, &SendResult{}, nil)
+}
+
+// messageURL returns the url of a message sent by the webhook.
+func (c *Client) messageURL(messageID string) (string, error) {
+	if messageID == "" {
+		return "", errors.New("message ID is required")
+	}
+	u, err := url.Parse(c.url)
+	if err != nil {
+		return "", err
+	}
+	return u.JoinPath("messages", messageID).String(), nil
+}
+
+// do sends req, waiting and re-sending it while Discord responds 429 until the
+// attempts run out, and fills result from the response. The response body is
+// decoded into v unless v is nil.
+func (c *Client) do(req *http.Request, result *SendResult, v interface{}) error {
+	ctx := req.Context()
+	maxAttempts := c.maxAttempts
+	if maxAttempts < 1 {
+		maxAttempts = DefaultMaxAttempts
+	}
+	if c.userAgent != "" {
+		req.Header.Set("User-Agent", c.userAgent)
+	}
+	for {
+		if c.limiter != nil {
+			if err := c.limiter.Wait(ctx, req); err != nil {
+				return err
+			}
+		}
+
+		result.Attempts++
+		var wait time.Duration
+		resp, err := c.client.Do(req)
 		if err != nil {
-			return nil, err
+			if c.limiter != nil {
+				cancelWait(c.limiter, req)
+			}
+			// Requests cancelled by ctx are not retried.
+			if !c.serverErrors || result.Attempts >= maxAttempts || ctx.Err() != nil {
+				return err
+			}
+			wait = c.backoffAfter(result.Attempts)
+			c.log(ctx, slog.LevelWarn, "request failed, retrying", "attempt", result.Attempts, "wait", wait, "error", c.redactError(err))
+		} else {
+			var limitErr error
+			if c.limiter != nil {
+				limitErr = c.limiter.Update(resp)
+			}
+			switch {
+			case resp.StatusCode >= http.StatusInternalServerError && c.serverErrors && result.Attempts < maxAttempts && limitErr == nil:
+				resp.Body.Close()
+				wait = c.backoffAfter(result.Attempts)
+				c.log(ctx, slog.LevelWarn, "server error, retrying", "attempt", result.Attempts, "wait", wait, "status", resp.StatusCode)
+			case resp.StatusCode != http.StatusTooManyRequests:
+				if err := readResult(resp, result, v); err != nil {
+					return err
+				}
+				return limitErr
+			case limitErr != nil:
+				resp.Body.Close()
+				return limitErr
+			default:
+				tooMany, err := parseTooManyRequests(resp)
+				resp.Body.Close()
+				if err != nil {
+					return err
+				}
+				if result.Attempts >= maxAttempts {
+					tooMany.Attempts = result.Attempts
+					return tooMany
+				}
+				wait = tooMany.RetryAfter
+				c.log(ctx, slog.LevelInfo, "rate limited, retrying", "attempt", result.Attempts, "wait", wait, "global", tooMany.Global)
+			}
+		}
+
+		if err := sleep(ctx, wait); err != nil {
+			return err
 		}
-		defer resp.Body.Close()
+		result.RetryWait += wait
 
-		if err := respError(resp); err != nil {
-			return nil, err
+		// The body of the previous attempt has been consumed.
+		retry := req.Clone(ctx)
+		if req.GetBody != nil {
+			if retry.Body, err = req.GetBody(); err != nil {
+				return err
+			}
 		}
+		req = retry
+	}
+}
+
+// backoffAfter returns the wait before retrying a server error after attempts.
+func (c *Client) backoffAfter(attempts int) time.Duration {
+	backoff := c.backoff
+	if backoff <= 0 {
+		backoff = DefaultBackoff
+	}
+	return backoff << (attempts - 1)
+}
+
+// readResult fills result from a successful response, decodes its body into v
+// unless v is nil and closes the body.
+func readResult(resp *http.Response, result *SendResult, v interface{}) error {
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	if err := respError(resp); err != nil {
+		return err
+	}
+
+	result.StatusCode = resp.StatusCode
+	result.RateLimit = parseRateLimit(resp.Header)
+	if v == nil || len(body) == 0 {
+		return nil
+	}
+	return json.Unmarshal(body, v)
+}
 
-		if err := handleRateLimit(resp.Header); err != nil {
-			return nil, err
+// executeURL adds the query parameters of a webhook request to rawURL.
+func executeURL(rawURL string, wait bool, threadID string) (string, error) {
+	var err error
+	if wait {
+		if rawURL, err = setQuery(rawURL, "wait", "true"); err != nil {
+			return "", err
+		}
+	}
+	if threadID != "" {
+		if rawURL, err = setQuery(rawURL, "thread_id", threadID); err != nil {
+			return "", err
 		}
-		responses = append(responses, resp)
 	}
-	return responses, nil
+	return rawURL, nil
+}
+
+// setQuery sets a query parameter of rawURL.
+func setQuery(rawURL, key, value string) (string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", err
+	}
+	q := u.Query()
+	q.Set(key, value)
+	u.RawQuery = q.Encode()
+	return u.String(), nil
 }
 
-func makeRequest(msg Message, url string, clt HttpClient) (*http.Response, error) {
+// makeRequest builds a request carrying msg in its body.
+func makeRequest(ctx context.Context, method, url string, msg Message) (*http.Request, error) {
 	contentType, body, err := writeBody(msg)
 	if err != nil {
 		return nil, err
 	}
-	req, err := http.NewRequest("POST", url, body)
+	req, err := http.NewRequestWithContext(ctx, method, url, body)
 	if err != nil {
 		return nil, err
 	}
 	req.Header.Add("Content-Type", contentType)
-	return clt.Do(req)
+	return req, nil
 }
 
 // writeBody serialises Message. Returning error even though it's always nil to be consistent with multipartBody
@@ -134,29 +751,13 @@ func writeFiles(files []*File, writer *multipart.Writer) error {
 			return err
 		}
 
-		if _, err = io.Copy(part, file.Reader); err != nil {
+		reader := file.Reader
+		if file.data != nil {
+			reader = bytes.NewReader(file.data)
+		}
+		if _, err = io.Copy(part, reader); err != nil {
 			return err
 		}
 	}
 	return nil
 }
-
-func respError(resp *http.Response) error {
-	var respBody map[string]interface{}
-	err := json.NewDecoder(resp.Body).Decode(&respBody)
-	switch {
-	// Body is empty.
-	case err == io.EOF:
-		return nil
-	case err != nil:
-		return err
-	}
-
-	// Discord API error message is written in "message" field in response body.
-	// "message" is of string type. "https://discord.com/developers/docs/reference#error-messages"
-	if message, ok := respBody["message"]; ok {
-		return errors.New("Discord API error: " + message.(string))
-	}
-
-	return nil
-}
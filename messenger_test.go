@@ -2,14 +2,17 @@ package messenger
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
+	"io"
 	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
 	"strconv"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 )
@@ -21,15 +24,156 @@ func TestNewClient(t *testing.T) {
 		c, err := NewClient(http.DefaultClient, url)
 
 		require.Equal(t, (*Client)(nil), c, "TestNewClient error failed")
-		require.EqualError(t, err, "invalid webhook URL")
+		require.EqualError(t, err, "invalid webhook URL: not a Discord API URL")
 	})
 
 	t.Run("success", func(t *testing.T) {
-		url := "https://discord.com/api/webhooks/something"
+		url := "https://discord.com/api/webhooks/123/token"
 
-		_, err := NewClient(http.DefaultClient, url)
+		c, err := NewClient(http.DefaultClient, url)
+
+		require.NoError(t, err)
+		require.Equal(t, url, c.url, "success failed")
+		require.Equal(t, DefaultMaxAttempts, c.maxAttempts, "success failed")
+		require.IsType(t, &HeaderRateLimiter{}, c.limiter, "success failed")
+	})
+
+	t.Run("Normalised url", func(t *testing.T) {
+		url := "https://canary.discordapp.com/api/v10/webhooks/123/token/?wait=true"
+
+		c, err := NewClient(http.DefaultClient, url)
+
+		require.NoError(t, err)
+		require.Equal(t, "https://discord.com/api/v10/webhooks/123/token", c.url, "Normalised url failed")
+	})
+
+	t.Run("From webhook", func(t *testing.T) {
+		w, _ := NewWebhookURL("123", "token")
+
+		c, err := NewClientFromWebhook(http.DefaultClient, w)
 
 		require.NoError(t, err)
+		require.Equal(t, "https://discord.com/api/webhooks/123/token", c.url, "From webhook failed")
+	})
+
+	t.Run("From invalid webhook", func(t *testing.T) {
+		c, err := NewClientFromWebhook(http.DefaultClient, WebhookURL{ID: "123"})
+
+		require.EqualError(t, err, "invalid webhook URL: invalid webhook token")
+		require.Nil(t, c, "From invalid webhook failed")
+	})
+
+	t.Run("WithMaxAttempts", func(t *testing.T) {
+		url := "https://discord.com/api/webhooks/123/token"
+
+		c, _ := NewClient(http.DefaultClient, url, WithMaxAttempts(5))
+		require.Equal(t, 5, c.maxAttempts, "WithMaxAttempts failed")
+
+		c, _ = NewClient(http.DefaultClient, url, WithMaxAttempts(0))
+		require.Equal(t, 1, c.maxAttempts, "WithMaxAttempts failed")
+	})
+
+	t.Run("WithWait", func(t *testing.T) {
+		url := "https://discord.com/api/webhooks/123/token"
+
+		c, _ := NewClient(http.DefaultClient, url, WithWait(true))
+
+		require.True(t, c.wait, "WithWait failed")
+	})
+
+	t.Run("WithBaseURL", func(t *testing.T) {
+		var path string
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			path = r.URL.Path
+			w.WriteHeader(http.StatusNoContent)
+		}))
+		defer server.Close()
+
+		c, err := NewClient(http.DefaultClient, server.URL+"/api/webhooks/123/token", WithBaseURL(server.URL+"/api/"))
+		require.NoError(t, err, "WithBaseURL failed")
+		_, err = c.Send([]Message{{Content: "test"}})
+
+		require.NoError(t, err, "WithBaseURL failed")
+		require.Equal(t, "/api/webhooks/123/token", path, "WithBaseURL failed")
+	})
+
+	t.Run("WithBaseURL Discord url", func(t *testing.T) {
+		url := "https://discord.com/api/v10/webhooks/123/token"
+
+		c, err := NewClient(http.DefaultClient, url, WithBaseURL("http://proxy.internal:8080/discord"))
+
+		require.NoError(t, err, "WithBaseURL Discord url failed")
+		require.Equal(t, "http://proxy.internal:8080/discord/v10/webhooks/123/token", c.url, "WithBaseURL Discord url failed")
+	})
+
+	t.Run("WithBaseURL from webhook", func(t *testing.T) {
+		w, _ := NewWebhookURL("123", "token")
+
+		c, err := NewClientFromWebhook(http.DefaultClient, w, WithBaseURL("http://127.0.0.1:8080"))
+
+		require.NoError(t, err, "WithBaseURL from webhook failed")
+		require.Equal(t, "http://127.0.0.1:8080/webhooks/123/token", c.url, "WithBaseURL from webhook failed")
+	})
+
+	t.Run("WithBaseURL invalid", func(t *testing.T) {
+		w, _ := NewWebhookURL("123", "token")
+
+		c, err := NewClient(http.DefaultClient, "https://discord.com/api/webhooks/123/token", WithBaseURL("127.0.0.1"))
+		require.EqualError(t, err, "invalid base URL", "WithBaseURL invalid failed")
+		require.Nil(t, c, "WithBaseURL invalid failed")
+
+		c, err = NewClientFromWebhook(http.DefaultClient, w, WithBaseURL("ftp://127.0.0.1"))
+		require.EqualError(t, err, "invalid base URL", "WithBaseURL invalid failed")
+		require.Nil(t, c, "WithBaseURL invalid failed")
+	})
+}
+
+func TestNew(t *testing.T) {
+	url := "https://discord.com/api/webhooks/123/token"
+
+	t.Run("Default HTTP client", func(t *testing.T) {
+		c, err := New(url)
+
+		require.NoError(t, err, "Default HTTP client failed")
+		require.Equal(t, http.DefaultClient, c.client, "Default HTTP client failed")
+		require.Equal(t, url, c.url, "Default HTTP client failed")
+	})
+
+	t.Run("WithHTTPClient", func(t *testing.T) {
+		hc := &http.Client{}
+
+		c, _ := New(url, WithHTTPClient(hc))
+		require.Equal(t, hc, c.client, "WithHTTPClient failed")
+
+		c, _ = NewClient(nil, url)
+		require.Equal(t, http.DefaultClient, c.client, "WithHTTPClient failed")
+	})
+
+	t.Run("Error", func(t *testing.T) {
+		c, err := New("wrong")
+
+		require.EqualError(t, err, "invalid webhook URL: not a Discord API URL")
+		require.Nil(t, c, "Error failed")
+	})
+
+	t.Run("Options", func(t *testing.T) {
+		limiter := NewChannelRateLimiter()
+
+		c, _ := New(url,
+			WithUserAgent("alerts/1.0"),
+			WithUsername("alerts"),
+			WithAvatarURL("https://example.com/a.png"),
+			WithAllowedMentions(AllowedMentions{}),
+			WithRateLimiter(limiter),
+			WithRetryPolicy(RetryPolicy{MaxAttempts: 5, ServerErrors: true, Backoff: time.Millisecond}),
+		)
+
+		require.Equal(t, "alerts/1.0", c.userAgent, "Options failed")
+		require.Equal(t, Message{Username: "alerts", AvatarURL: "https://example.com/a.png", AllowedMentions: &AllowedMentions{}}, c.defaults, "Options failed")
+		require.Equal(t, limiter, c.limiter, "Options failed")
+		require.Equal(t, 5, c.maxAttempts, "Options failed")
+		require.True(t, c.serverErrors, "Options failed")
+		require.Equal(t, time.Millisecond, c.backoff, "Options failed")
 	})
 }
 
@@ -52,6 +196,16 @@ func TestClientSend(t *testing.T) {
 		require.Error(t, err)
 	})
 
+	t.Run("Do error", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+		server.Close() // Close before req sent
+		c := &Client{url: server.URL, client: server.Client()}
+
+		_, err := c.Send([]Message{{Content: "Ok"}})
+
+		require.Error(t, err)
+	})
+
 	t.Run("respError error", func(t *testing.T) {
 		// Return a payload containing error message
 		resp := make(map[string]string)
@@ -68,7 +222,7 @@ func TestClientSend(t *testing.T) {
 
 		_, err := c.Send([]Message{{Content: "Ok"}})
 
-		require.Equal(t, errors.New("Discord API error: test error"), err, "respError error failed")
+		require.Equal(t, &APIError{StatusCode: http.StatusOK, Message: "test error"}, errors.Unwrap(err), "respError error failed")
 	})
 
 	t.Run("ratelimit.Wait error", func(t *testing.T) {
@@ -77,22 +231,734 @@ func TestClientSend(t *testing.T) {
 		}))
 		defer server.Close()
 
-		c := &Client{url: server.URL, client: http.DefaultClient}
+		c := &Client{url: server.URL, client: http.DefaultClient, limiter: &HeaderRateLimiter{}}
 
-		_, err := c.Send([]Message{{Content: "Ok"}})
+		results, err := c.Send([]Message{{Content: "Ok"}})
+
+		require.IsType(t, &strconv.NumError{}, errors.Unwrap(err), "ratelimit.Wait error failed")
+		// The message was posted before the headers failed to parse.
+		require.Len(t, results, 1, "ratelimit.Wait error failed")
+		require.Empty(t, err.(*PartialSendError).Pending, "ratelimit.Wait error failed")
+		require.True(t, err.(*PartialSendError).Delivered, "ratelimit.Wait error failed")
+		require.Equal(t, `message 0 was delivered but handling its response failed after 1 delivered: strconv.Atoi: parsing "a": invalid syntax`, err.Error(), "ratelimit.Wait error failed")
+	})
+
+	t.Run("Remaining without reset", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("x-ratelimit-remaining", "4")
+			w.WriteHeader(http.StatusNoContent)
+		}))
+		defer server.Close()
+		c := &Client{url: server.URL, client: http.DefaultClient, limiter: &HeaderRateLimiter{}}
+
+		results, err := c.Send([]Message{{Content: "Ok"}})
 
-		require.IsType(t, &strconv.NumError{}, err, "respError error failed")
+		require.NoError(t, err, "Remaining without reset failed")
+		require.Len(t, results, 1, "Remaining without reset failed")
 	})
 
 	t.Run("Success", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("x-ratelimit-bucket", "abc")
+			w.Header().Set("x-ratelimit-remaining", "4")
+			w.Header().Set("x-ratelimit-reset-after", "1")
+			w.WriteHeader(http.StatusNoContent)
+		}))
+		defer server.Close()
+
+		c := &Client{url: server.URL, client: http.DefaultClient}
+
+		results, err := c.Send([]Message{{Content: "Ok"}})
+
+		require.NoError(t, err)
+		require.Len(t, results, 1, "Success failed")
+		require.Equal(t, Message{Content: "Ok"}, results[0].Message, "Success failed")
+		require.Equal(t, http.StatusNoContent, results[0].StatusCode, "Success failed")
+		require.Equal(t, "abc", results[0].RateLimit.Bucket, "Success failed")
+		require.Equal(t, 4, results[0].RateLimit.Remaining, "Success failed")
+		require.Equal(t, 1, results[0].Attempts, "Success failed")
+		require.Nil(t, results[0].WebhookMessage, "Success failed")
+	})
+}
+
+func TestClientSendContext(t *testing.T) {
+	t.Run("Cancelled before send", func(t *testing.T) {
 		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
 		defer server.Close()
+		c := &Client{url: server.URL, client: http.DefaultClient}
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		responses, err := c.SendContext(ctx, []Message{{Content: "Ok"}})
+
+		require.ErrorIs(t, err, context.Canceled)
+		require.Empty(t, responses, "Cancelled before send failed")
+	})
+
+	t.Run("Deadline during rate limit wait", func(t *testing.T) {
+		var count int
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			count++
+			w.Header().Set("x-ratelimit-remaining", "0")
+			w.Header().Set("x-ratelimit-reset-after", "60")
+		}))
+		defer server.Close()
+		c := &Client{url: server.URL, client: http.DefaultClient, limiter: &HeaderRateLimiter{}}
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+
+		responses, err := c.SendContext(ctx, []Message{{Content: "1"}, {Content: "2"}})
+
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+		require.Len(t, responses, 1, "Deadline during rate limit wait failed")
+		require.Equal(t, 1, count, "Deadline during rate limit wait failed")
+	})
+
+	t.Run("Cancelled during request", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		release := make(chan struct{})
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			cancel()
+			<-release
+		}))
+		defer server.Close()
+		defer close(release)
+		c := &Client{url: server.URL, client: http.DefaultClient}
+
+		responses, err := c.SendContext(ctx, []Message{{Content: "Ok"}})
+
+		require.ErrorIs(t, err, context.Canceled)
+		require.Empty(t, responses, "Cancelled during request failed")
+	})
+}
+
+func TestClientSendWait(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("wait") != "true" {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		w.Write([]byte(`{
+			"id": "10",
+			"channel_id": "20",
+			"webhook_id": "30",
+			"author": {"id": "30", "username": "bot", "bot": true},
+			"content": "Ok",
+			"attachments": [{"id": "40", "filename": "a.txt", "size": 4, "url": "https://cdn.discordapp.com/a.txt", "proxy_url": "https://media.discordapp.net/a.txt"}],
+			"timestamp": "2023-11-14T22:13:20.000000+00:00"
+		}`))
+	}))
+	defer server.Close()
+	c, _ := NewClient(http.DefaultClient, "https://discord.com/api/webhooks/123/token", WithWait(true))
+	c.url = server.URL + "/api/webhooks/30/token"
+
+	results, err := c.Send([]Message{{Content: "Ok"}})
+
+	require.NoError(t, err, "Client send wait failed")
+	msg := results[0].WebhookMessage
+	require.NotNil(t, msg, "Client send wait failed")
+	require.Equal(t, "10", msg.ID, "Client send wait failed")
+	require.Equal(t, "20", msg.ChannelID, "Client send wait failed")
+	require.Equal(t, "bot", msg.Author.Username, "Client send wait failed")
+	require.Equal(t, "a.txt", msg.Attachments[0].Filename, "Client send wait failed")
+	require.Nil(t, msg.EditedTimestamp, "Client send wait failed")
+}
+
+func TestClientEditMessage(t *testing.T) {
+	t.Run("validateMessage error", func(t *testing.T) {
+		c := &Client{url: "https://discord.com/api/webhooks/1/token", client: http.DefaultClient}
+
+		_, err := c.EditMessage(context.Background(), "10", Message{})
+
+		require.EqualError(t, err, "Message must have either content or embeds")
+	})
+
+	t.Run("Message ID required", func(t *testing.T) {
+		c := &Client{url: "https://discord.com/api/webhooks/1/token", client: http.DefaultClient}
+
+		_, err := c.EditMessage(context.Background(), "", Message{Content: "Ok"})
+
+		require.EqualError(t, err, "message ID is required")
+	})
+
+	t.Run("Success", func(t *testing.T) {
+		var method, path, contentType, body string
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			method, path, contentType = r.Method, r.URL.Path, r.Header.Get("Content-Type")
+			b, _ := io.ReadAll(r.Body)
+			body = string(b)
+			w.Write([]byte(`{"id": "10", "channel_id": "20", "content": "Deploy done", "timestamp": "2023-11-14T22:13:20.000000+00:00", "edited_timestamp": "2023-11-14T22:14:20.000000+00:00"}`))
+		}))
+		defer server.Close()
+		c := &Client{url: server.URL + "/api/webhooks/1/token", client: http.DefaultClient, limiter: &HeaderRateLimiter{}}
+		msg := Message{Content: "Deploy done", Files: []*File{{Name: "log.txt", Reader: strings.NewReader("log")}}}
+
+		edited, err := c.EditMessage(context.Background(), "10", msg)
+
+		require.NoError(t, err, "Success failed")
+		require.Equal(t, http.MethodPatch, method, "Success failed")
+		require.Equal(t, "/api/webhooks/1/token/messages/10", path, "Success failed")
+		require.Contains(t, contentType, "multipart/form-data", "Success failed")
+		require.Contains(t, body, "log", "Success failed")
+		require.Equal(t, "Deploy done", edited.Content, "Success failed")
+		require.NotNil(t, edited.EditedTimestamp, "Success failed")
+	})
+
+	t.Run("Unknown message", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"message": "Unknown Message", "code": 10008}`))
+		}))
+		defer server.Close()
+		c := &Client{url: server.URL, client: http.DefaultClient}
+
+		edited, err := c.EditMessage(context.Background(), "10", Message{Content: "Ok"})
+
+		var apiErr *APIError
+		require.ErrorAs(t, err, &apiErr, "Unknown message failed")
+		require.Equal(t, CodeUnknownMessage, apiErr.Code, "Unknown message failed")
+		require.Nil(t, edited, "Unknown message failed")
+	})
+}
+
+func TestClientDeleteMessage(t *testing.T) {
+	t.Run("Message ID required", func(t *testing.T) {
+		c := &Client{url: "https://discord.com/api/webhooks/1/token", client: http.DefaultClient}
+
+		err := c.DeleteMessage(context.Background(), "")
+
+		require.EqualError(t, err, "message ID is required")
+	})
+
+	t.Run("URL error", func(t *testing.T) {
+		c := &Client{url: "%%", client: http.DefaultClient}
+
+		err := c.DeleteMessage(context.Background(), "10")
+
+		require.Error(t, err, "URL error failed")
+	})
+
+	t.Run("Retry after 429", func(t *testing.T) {
+		var requests []string
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requests = append(requests, r.Method+" "+r.URL.Path)
+			if len(requests) == 1 {
+				w.WriteHeader(http.StatusTooManyRequests)
+				w.Write([]byte(`{"message": "You are being rate limited.", "retry_after": 0.01}`))
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+		}))
+		defer server.Close()
+		c := &Client{url: server.URL + "/api/webhooks/1/token", client: http.DefaultClient}
 
+		err := c.DeleteMessage(context.Background(), "10")
+
+		require.NoError(t, err, "Retry after 429 failed")
+		require.Equal(t, []string{
+			"DELETE /api/webhooks/1/token/messages/10",
+			"DELETE /api/webhooks/1/token/messages/10",
+		}, requests, "Retry after 429 failed")
+	})
+}
+
+func TestClientSendThread(t *testing.T) {
+	t.Run("Existing thread", func(t *testing.T) {
+		var query string
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			query = r.URL.RawQuery
+		}))
+		defer server.Close()
+		c := &Client{url: server.URL, client: http.DefaultClient}
+
+		_, err := c.Send([]Message{{Content: "Ok", ThreadID: "99"}})
+
+		require.NoError(t, err, "Existing thread failed")
+		require.Equal(t, "thread_id=99", query, "Existing thread failed")
+	})
+
+	t.Run("Divided message stays in created post", func(t *testing.T) {
+		type request struct {
+			query   string
+			payload map[string]interface{}
+		}
+		var requests []request
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var payload map[string]interface{}
+			json.NewDecoder(r.Body).Decode(&payload)
+			requests = append(requests, request{r.URL.RawQuery, payload})
+			if r.URL.Query().Get("wait") == "true" {
+				w.Write([]byte(`{"id": "100", "channel_id": "200"}`))
+			}
+		}))
+		defer server.Close()
+		c := &Client{url: server.URL, client: http.DefaultClient}
+		embeds := []Embed{
+			{Description: strings.Repeat("t", 4000)},
+			{Description: strings.Repeat("e", 4000)},
+			{Description: strings.Repeat("s", 4000)},
+		}
+		msgs := []Message{
+			{Content: "Incident 1", Embeds: embeds, ThreadName: "Incident 1", AppliedTags: []string{"5"}},
+			{Content: "Incident 2", ThreadName: "Incident 2"},
+		}
+
+		results, err := c.Send(msgs)
+
+		require.NoError(t, err, "Divided message stays in created post failed")
+		require.Len(t, results, 4, "Divided message stays in created post failed")
+		require.Equal(t, "wait=true", requests[0].query, "Divided message stays in created post failed")
+		require.Equal(t, "Incident 1", requests[0].payload["thread_name"], "Divided message stays in created post failed")
+		require.Equal(t, []interface{}{"5"}, requests[0].payload["applied_tags"], "Divided message stays in created post failed")
+		for _, r := range requests[1:3] {
+			require.Equal(t, "thread_id=200", r.query, "Divided message stays in created post failed")
+			require.NotContains(t, r.payload, "thread_name", "Divided message stays in created post failed")
+			require.NotContains(t, r.payload, "applied_tags", "Divided message stays in created post failed")
+		}
+		// The next message creates its own post.
+		require.Equal(t, "wait=true", requests[3].query, "Divided message stays in created post failed")
+		require.Equal(t, "Incident 2", requests[3].payload["thread_name"], "Divided message stays in created post failed")
+	})
+
+	t.Run("Delete in thread", func(t *testing.T) {
+		var query string
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			query = r.URL.RawQuery
+			w.WriteHeader(http.StatusNoContent)
+		}))
+		defer server.Close()
+		c := &Client{url: server.URL, client: http.DefaultClient}
+
+		err := c.DeleteThreadMessage(context.Background(), "99", "10")
+
+		require.NoError(t, err, "Delete in thread failed")
+		require.Equal(t, "thread_id=99", query, "Delete in thread failed")
+	})
+
+	t.Run("Edit in thread", func(t *testing.T) {
+		var query string
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			query = r.URL.RawQuery
+		}))
+		defer server.Close()
+		c := &Client{url: server.URL, client: http.DefaultClient}
+
+		_, err := c.EditMessage(context.Background(), "10", Message{Content: "Ok", ThreadID: "99"})
+
+		require.NoError(t, err, "Edit in thread failed")
+		require.Equal(t, "thread_id=99", query, "Edit in thread failed")
+	})
+}
+
+func TestClientSendSplitContent(t *testing.T) {
+	t.Run("Split", func(t *testing.T) {
+		var contents []string
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var msg Message
+			json.NewDecoder(r.Body).Decode(&msg)
+			contents = append(contents, msg.Content)
+		}))
+		defer server.Close()
 		c := &Client{url: server.URL, client: http.DefaultClient}
+		WithSplitContent(true)(c)
+		content := strings.Repeat("log line\n", 300)
+
+		results, err := c.Send([]Message{{Content: content}})
+
+		require.NoError(t, err, "Split failed")
+		require.Len(t, results, 2, "Split failed")
+		require.Equal(t, content, contents[0]+"\n"+contents[1], "Split failed")
+	})
+
+	t.Run("Disabled", func(t *testing.T) {
+		c := &Client{client: http.DefaultClient}
+
+		_, err := c.Send([]Message{{Content: strings.Repeat("a", MessageContentLimit+1)}})
+
+		require.EqualError(t, err, "Message content length exceeding Discord API limit")
+	})
+}
+
+func TestClientSendSplitEmbeds(t *testing.T) {
+	fields := make([]Field, 30)
+	for i := range fields {
+		fields[i] = Field{Name: "name", Value: "value"}
+	}
+
+	t.Run("Split", func(t *testing.T) {
+		var received []Message
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var msg Message
+			json.NewDecoder(r.Body).Decode(&msg)
+			received = append(received, msg)
+		}))
+		defer server.Close()
+		c := &Client{url: server.URL, client: http.DefaultClient}
+		WithSplitEmbeds(true)(c)
+
+		results, err := c.Send([]Message{{Embeds: []Embed{{Title: "Report", Fields: fields}}}})
+
+		require.NoError(t, err, "Split failed")
+		require.Len(t, results, 1, "Split failed")
+		require.Len(t, received[0].Embeds, 2, "Split failed")
+		require.Equal(t, "(cont.)", received[0].Embeds[1].Title, "Split failed")
+	})
+
+	t.Run("Disabled", func(t *testing.T) {
+		c := &Client{client: http.DefaultClient}
+
+		_, err := c.Send([]Message{{Embeds: []Embed{{Title: "Report", Fields: fields}}}})
+
+		require.EqualError(t, err, "Embed field number length exceeding Discord API limit")
+	})
+}
+
+func TestExecuteURL(t *testing.T) {
+	t.Run("No query", func(t *testing.T) {
+		u, err := executeURL("https://discord.com/api/webhooks/1/token", false, "")
+
+		require.NoError(t, err, "No query failed")
+		require.Equal(t, "https://discord.com/api/webhooks/1/token", u, "No query failed")
+	})
+
+	t.Run("Wait and thread", func(t *testing.T) {
+		u, err := executeURL("https://discord.com/api/webhooks/1/token", true, "2")
+
+		require.NoError(t, err, "Wait and thread failed")
+		require.Equal(t, "https://discord.com/api/webhooks/1/token?thread_id=2&wait=true", u, "Wait and thread failed")
+	})
+
+	t.Run("Parse error", func(t *testing.T) {
+		_, err := executeURL("%%", false, "2")
+
+		require.Error(t, err, "Parse error failed")
+	})
+}
+
+func TestSetQuery(t *testing.T) {
+	t.Run("Parse error", func(t *testing.T) {
+		_, err := setQuery("%%", "wait", "true")
+
+		require.Error(t, err, "Parse error failed")
+	})
+
+	t.Run("Existing query kept", func(t *testing.T) {
+		u, err := setQuery("https://discord.com/api/webhooks/1/token?thread_id=2", "wait", "true")
+
+		require.NoError(t, err, "Existing query kept failed")
+		require.Equal(t, "https://discord.com/api/webhooks/1/token?thread_id=2&wait=true", u, "Existing query kept failed")
+	})
+}
+
+func TestClientResumeFrom(t *testing.T) {
+	msg := Message{ThreadName: "Incident", Embeds: make([]Embed, MessageEmbedNumLimit*2+1)}
+	for i := range msg.Embeds {
+		msg.Embeds[i] = Embed{Title: "embed"}
+	}
+
+	t.Run("In created post", func(t *testing.T) {
+		c := &Client{client: http.DefaultClient}
+
+		partialErr, err := c.resumeFrom(context.Background(), msg, 1, "300")
+
+		require.NoError(t, err, "In created post failed")
+		require.Equal(t, 1, partialErr.Index, "In created post failed")
+		require.Len(t, partialErr.Pending, 2, "In created post failed")
+		for _, m := range partialErr.Pending {
+			require.Equal(t, "300", m.ThreadID, "In created post failed")
+			require.Empty(t, m.ThreadName, "In created post failed")
+		}
+		require.Equal(t, &msg, partialErr.origins[0], "In created post failed")
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		sink := &MemoryDeadLetters{}
+		c := &Client{client: http.DefaultClient}
+		WithDeadLetters(sink)(c)
+
+		_, err := c.resumeFrom(context.Background(), Message{Content: strings.Repeat("a", MessageContentLimit+1)}, 1, "")
+
+		require.Error(t, err, "Invalid failed")
+		require.Len(t, sink.Letters(), 1, "Invalid failed")
+	})
+}
+
+func TestPartialSendError(t *testing.T) {
+	t.Run("Failed midway", func(t *testing.T) {
+		var received []string
+		fail := true
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var msg Message
+			json.NewDecoder(r.Body).Decode(&msg)
+			if msg.Content == "3" && fail {
+				w.WriteHeader(http.StatusInternalServerError)
+				w.Write([]byte(`{"message": "test"}`))
+				return
+			}
+			received = append(received, msg.Content)
+		}))
+		defer server.Close()
+		c := &Client{url: server.URL, client: http.DefaultClient}
+		msgs := []Message{{Content: "1"}, {Content: "2"}, {Content: "3"}, {Content: "4"}, {Content: "5"}}
+
+		results, err := c.Send(msgs)
+
+		var partialErr *PartialSendError
+		require.ErrorAs(t, err, &partialErr, "Failed midway failed")
+		require.Equal(t, 2, partialErr.Index, "Failed midway failed")
+		require.Len(t, partialErr.Results, 2, "Failed midway failed")
+		require.Equal(t, results, partialErr.Results, "Failed midway failed")
+		require.Equal(t, msgs[2:], partialErr.Pending, "Failed midway failed")
+		require.EqualError(t, err, "sending message 2 failed after 2 delivered: Discord API error: test")
+		require.False(t, partialErr.Delivered, "Failed midway failed")
+
+		fail = false
+		results, err = c.Resume(context.Background(), partialErr)
+
+		require.NoError(t, err, "Failed midway failed")
+		require.Len(t, results, 5, "Failed midway failed")
+		require.Equal(t, []string{"1", "2", "3", "4", "5"}, received, "Failed midway failed")
+	})
+
+	t.Run("Resume fails again", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var msg Message
+			json.NewDecoder(r.Body).Decode(&msg)
+			if msg.Content == "3" {
+				w.WriteHeader(http.StatusInternalServerError)
+				w.Write([]byte(`{"message": "test"}`))
+			}
+		}))
+		defer server.Close()
+		c := &Client{url: server.URL, client: http.DefaultClient}
+		partialErr := &PartialSendError{
+			Index:   1,
+			Results: []SendResult{{StatusCode: http.StatusNoContent}},
+			Pending: []Message{{Content: "2"}, {Content: "3"}},
+		}
+
+		results, err := c.Resume(context.Background(), partialErr)
+
+		var again *PartialSendError
+		require.ErrorAs(t, err, &again, "Resume fails again failed")
+		require.Equal(t, 2, again.Index, "Resume fails again failed")
+		require.Len(t, results, 2, "Resume fails again failed")
+		require.Len(t, partialErr.Results, 1, "Resume fails again failed")
+	})
+
+	t.Run("Files resent on resume", func(t *testing.T) {
+		var bodies []string
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			b, _ := io.ReadAll(r.Body)
+			bodies = append(bodies, string(b))
+			if len(bodies) == 1 {
+				w.WriteHeader(http.StatusInternalServerError)
+				w.Write([]byte(`{"message": "test"}`))
+			}
+		}))
+		defer server.Close()
+		c := &Client{url: server.URL, client: http.DefaultClient}
+		msg := Message{Content: "Ok", Files: []*File{{Name: "a.txt", Reader: strings.NewReader("file content")}}}
+
+		_, err := c.Send([]Message{msg})
+		require.Error(t, err, "Files resent on resume failed")
+		_, err = c.Resume(context.Background(), err.(*PartialSendError))
+
+		require.NoError(t, err, "Files resent on resume failed")
+		require.Contains(t, bodies[1], "file content", "Files resent on resume failed")
+	})
+}
+
+func TestClientSendRetry(t *testing.T) {
+	t.Run("Retry after 429", func(t *testing.T) {
+		var bodies []string
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			b, _ := io.ReadAll(r.Body)
+			bodies = append(bodies, string(b))
+			if len(bodies) == 1 {
+				w.WriteHeader(http.StatusTooManyRequests)
+				w.Write([]byte(`{"message": "You are being rate limited.", "retry_after": 0.01, "global": false}`))
+			}
+		}))
+		defer server.Close()
+		c := &Client{url: server.URL, client: http.DefaultClient}
+		msg := Message{Content: "Ok", Files: []*File{{Name: "a.txt", Reader: strings.NewReader("file")}}}
+
+		results, err := c.Send([]Message{msg})
+
+		require.NoError(t, err, "Retry after 429 failed")
+		require.Equal(t, 2, results[0].Attempts, "Retry after 429 failed")
+		require.Equal(t, 10*time.Millisecond, results[0].RetryWait, "Retry after 429 failed")
+		require.Equal(t, bodies[0], bodies[1], "Retry after 429 failed")
+		require.Contains(t, bodies[1], "file", "Retry after 429 failed")
+	})
+
+	t.Run("Attempts exhausted", func(t *testing.T) {
+		var count int
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			count++
+			w.Header().Set("Retry-After", "0")
+			w.Header().Set("X-RateLimit-Global", "true")
+			w.WriteHeader(http.StatusTooManyRequests)
+		}))
+		defer server.Close()
+		c := &Client{url: server.URL, client: http.DefaultClient, maxAttempts: 2}
 
 		_, err := c.Send([]Message{{Content: "Ok"}})
 
-		require.NoError(t, err)
+		var limitErr *RateLimitError
+		require.ErrorAs(t, err, &limitErr, "Attempts exhausted failed")
+		require.Equal(t, 2, limitErr.Attempts, "Attempts exhausted failed")
+		require.True(t, limitErr.Global, "Attempts exhausted failed")
+		require.Equal(t, 2, count, "Attempts exhausted failed")
+	})
+
+	t.Run("Global without Retry-After", func(t *testing.T) {
+		var count int
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			count++
+			if count == 1 {
+				w.Header().Set("X-RateLimit-Global", "true")
+				w.WriteHeader(http.StatusTooManyRequests)
+				w.Write([]byte(`{"message": "You are being rate limited.", "retry_after": 0.01, "global": true}`))
+			}
+		}))
+		defer server.Close()
+		c := &Client{url: server.URL, client: http.DefaultClient, limiter: &HeaderRateLimiter{}}
+
+		results, err := c.Send([]Message{{Content: "Ok"}})
+
+		require.NoError(t, err, "Global without Retry-After failed")
+		require.Equal(t, 2, results[0].Attempts, "Global without Retry-After failed")
+	})
+
+	t.Run("Retry-After error", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Retry-After", "a")
+			w.WriteHeader(http.StatusTooManyRequests)
+		}))
+		defer server.Close()
+		c := &Client{url: server.URL, client: http.DefaultClient}
+
+		_, err := c.Send([]Message{{Content: "Ok"}})
+
+		require.IsType(t, &strconv.NumError{}, errors.Unwrap(err), "Retry-After error failed")
+	})
+
+	t.Run("Server error", func(t *testing.T) {
+		var count int
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			count++
+			if count < 3 {
+				w.WriteHeader(http.StatusBadGateway)
+			}
+		}))
+		defer server.Close()
+		c := &Client{url: server.URL, client: http.DefaultClient, maxAttempts: 3, serverErrors: true, backoff: time.Millisecond}
+
+		results, err := c.Send([]Message{{Content: "Ok"}})
+
+		require.NoError(t, err, "Server error failed")
+		require.Equal(t, 3, results[0].Attempts, "Server error failed")
+		require.Equal(t, 3*time.Millisecond, results[0].RetryWait, "Server error failed")
+	})
+
+	t.Run("Server error not retried", func(t *testing.T) {
+		var count int
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			count++
+			w.WriteHeader(http.StatusBadGateway)
+		}))
+		defer server.Close()
+		c := &Client{url: server.URL, client: http.DefaultClient, maxAttempts: 3}
+
+		_, err := c.Send([]Message{{Content: "Ok"}})
+
+		var apiErr *APIError
+		require.ErrorAs(t, err, &apiErr, "Server error not retried failed")
+		require.Equal(t, http.StatusBadGateway, apiErr.StatusCode, "Server error not retried failed")
+		require.Equal(t, 1, count, "Server error not retried failed")
+	})
+
+	t.Run("Connection error", func(t *testing.T) {
+		server := httptest.NewServer(http.NotFoundHandler())
+		server.Close()
+		c := &Client{url: server.URL, client: http.DefaultClient, maxAttempts: 2, serverErrors: true, backoff: time.Millisecond}
+
+		results, err := c.Send([]Message{{Content: "Ok"}})
+
+		var partialErr *PartialSendError
+		require.ErrorAs(t, err, &partialErr, "Connection error failed")
+		require.Empty(t, results, "Connection error failed")
+	})
+
+	t.Run("Cancelled during retry wait", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Retry-After", "60")
+			w.WriteHeader(http.StatusTooManyRequests)
+		}))
+		defer server.Close()
+		c := &Client{url: server.URL, client: http.DefaultClient}
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+
+		_, err := c.SendContext(ctx, []Message{{Content: "Ok"}})
+
+		require.ErrorIs(t, err, context.DeadlineExceeded, "Cancelled during retry wait failed")
+	})
+}
+
+type readerMock struct{}
+
+func (r readerMock) Read(p []byte) (n int, err error) {
+	return 0, errors.New("Test")
+}
+
+func TestReadResult(t *testing.T) {
+	t.Run("Read error", func(t *testing.T) {
+		resp := &http.Response{Body: io.NopCloser(readerMock{})}
+
+		err := readResult(resp, &SendResult{}, nil)
+
+		require.EqualError(t, err, "Test", "Read error failed")
+	})
+
+	t.Run("respError error", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		rr.WriteHeader(http.StatusBadRequest)
+		rr.Write([]byte(`{"message": "test"}`))
+
+		err := readResult(rr.Result(), &SendResult{}, nil)
+
+		require.EqualError(t, err, "Discord API error: test", "respError error failed")
+	})
+
+	t.Run("Webhook message", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		rr.Header().Set("x-ratelimit-limit", "5")
+		rr.Write([]byte(`{"id": "1", "channel_id": "2", "content": "Ok", "timestamp": "2023-11-14T22:13:20.000000+00:00"}`))
+		var result SendResult
+		var msg WebhookMessage
+
+		err := readResult(rr.Result(), &result, &msg)
+
+		require.NoError(t, err, "Webhook message failed")
+		require.Equal(t, http.StatusOK, result.StatusCode, "Webhook message failed")
+		require.Equal(t, 5, result.RateLimit.Limit, "Webhook message failed")
+		require.Equal(t, "1", msg.ID, "Webhook message failed")
+		require.Equal(t, "2", msg.ChannelID, "Webhook message failed")
+		require.Equal(t, time.Unix(1700000000, 0).UTC(), msg.Timestamp.UTC(), "Webhook message failed")
+	})
+
+	t.Run("Empty body", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		rr.WriteHeader(http.StatusNoContent)
+		var msg WebhookMessage
+
+		err := readResult(rr.Result(), &SendResult{}, &msg)
+
+		require.NoError(t, err, "Empty body failed")
+		require.Equal(t, WebhookMessage{}, msg, "Empty body failed")
 	})
 }
 
@@ -101,46 +967,31 @@ func TestMakeRequest(t *testing.T) {
 		msg := Message{Files: []*File{
 			{Name: "Test", Reader: bytes.NewBuffer([]byte{1})},
 		}}
-		clt := &http.Client{}
-		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
-		defer server.Close()
 
-		_, err := makeRequest(msg, server.URL, clt)
+		req, err := makeRequest(context.Background(), http.MethodPost, "https://example.com", msg)
 
 		require.NoError(t, err, "multipartBody no error failed")
+		require.Contains(t, req.Header.Get("Content-Type"), "multipart/form-data", "multipartBody no error failed")
 	})
 
 	t.Run("NewRequest error", func(t *testing.T) {
 		msg := Message{}
 		url := "%%" // This will make NewRequest failed
-		clt := &http.Client{}
 
-		resp, err := makeRequest(msg, url, clt)
-
-		require.Error(t, err)
-		require.Nil(t, resp)
-	})
-
-	t.Run("Do error", func(t *testing.T) {
-		msg := Message{}
-		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
-		server.Close() // Close before req sent
-		clt := server.Client()
-
-		_, err := makeRequest(msg, server.URL, clt)
+		req, err := makeRequest(context.Background(), http.MethodPost, url, msg)
 
 		require.Error(t, err)
+		require.Nil(t, req)
 	})
 
 	t.Run("No error", func(t *testing.T) {
 		msg := Message{Content: "hi"}
-		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
-		defer server.Close()
-		clt := server.Client()
 
-		_, err := makeRequest(msg, server.URL, clt)
+		req, err := makeRequest(context.Background(), http.MethodPost, "https://example.com", msg)
 
 		require.NoError(t, err)
+		require.Equal(t, "POST", req.Method, "No error failed")
+		require.Equal(t, "application/json", req.Header.Get("Content-Type"), "No error failed")
 	})
 }
 
@@ -234,53 +1085,3 @@ func TestWriteFiles(t *testing.T) {
 		require.NoError(t, err, "No error failed")
 	})
 }
-
-func TestRespError(t *testing.T) {
-	type body struct {
-		Message string `json:"message,omitempty"`
-		Other   string `json:"other,omitempty"`
-	}
-
-	t.Run("Has error in response", func(t *testing.T) {
-		rawBody := body{Message: "test"}
-		jsonBody, _ := json.Marshal(rawBody)
-		rr := httptest.NewRecorder()
-		rr.Write(jsonBody)
-
-		err := respError(rr.Result())
-
-		require.Equal(t, errors.New("Discord API error: test"), err, "Has error in response failed")
-	})
-
-	t.Run("Decode return if EOF", func(t *testing.T) {
-		rr := httptest.NewRecorder()
-		// Write empty body to trigger decode EOF error.
-		rr.Write(nil)
-
-		err := respError(rr.Result())
-
-		require.IsType(t, nil, err, "Decode return if EOF failed")
-	})
-
-	t.Run("Decode error", func(t *testing.T) {
-		body, _ := json.Marshal(1)
-		rr := httptest.NewRecorder()
-		// Write empty body to trigger decode EOF error.
-		rr.Write(body)
-
-		err := respError(rr.Result())
-
-		require.IsType(t, &json.UnmarshalTypeError{}, err, "Decode error failed")
-	})
-
-	t.Run("No error", func(t *testing.T) {
-		rawBody := body{Other: "Ok"}
-		jsonBody, _ := json.Marshal(rawBody)
-		rr := httptest.NewRecorder()
-		rr.Write(jsonBody)
-
-		err := respError(rr.Result())
-
-		require.Equal(t, nil, err, "Resp no error failed")
-	})
-}
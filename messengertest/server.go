@@ -0,0 +1,356 @@
+// Package messengertest provides a fake Discord webhook endpoint, to test code
+// sending messages with messenger without reaching Discord.
+package messengertest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"mime"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/qiyihuang/messenger"
+	"github.com/qiyihuang/messenger/internal/validation"
+)
+
+// Identifiers of the fake webhook.
+const (
+	WebhookID    = "100000000000000001"
+	WebhookToken = "messengertest-token"
+	ChannelID    = "100000000000000002"
+)
+
+// Discord allows 5 messages every 2 seconds per webhook.
+const (
+	DefaultRateLimit       = 5
+	DefaultRateLimitWindow = 2 * time.Second
+)
+
+// JSON error codes returned by the fake, see messenger.APIError.
+const (
+	codeInvalidJSON = 50109
+)
+
+// Option configures a Server.
+type Option func(*Server)
+
+// WithRateLimit sets the number of messages accepted per window, e.g. a short
+// window keeps tests fast while still exercising the rate limit.
+func WithRateLimit(limit int, window time.Duration) Option {
+	return func(s *Server) {
+		s.limit = limit
+		s.window = window
+	}
+}
+
+// Server is a fake Discord webhook endpoint. It accepts messages sent to
+// WebhookURL like Discord would: the limits of messenger are enforced, rate
+// limit headers are sent along 429 responses once the rate limit is exceeded
+// and created messages are returned when asked with wait=true.
+type Server struct {
+	*httptest.Server
+	limit  int
+	window time.Duration
+
+	mu          sync.Mutex
+	messages    []messenger.Message
+	remaining   int
+	reset       time.Time
+	rateLimited int
+	lastID      uint64
+}
+
+// NewServer starts a Server, which should be closed when finished.
+func NewServer(opts ...Option) *Server {
+	s := &Server{
+		limit:  DefaultRateLimit,
+		window: DefaultRateLimitWindow,
+		lastID: 200000000000000000,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	s.Server = httptest.NewServer(s)
+	return s
+}
+
+// BaseURL returns the API base url of the Server, to pass to
+// messenger.WithBaseURL.
+func (s *Server) BaseURL() string {
+	return s.URL + "/api"
+}
+
+// WebhookURL returns the url of the fake webhook.
+func (s *Server) WebhookURL() string {
+	return s.BaseURL() + "/webhooks/" + WebhookID + "/" + WebhookToken
+}
+
+// Messages returns the messages accepted so far, in the order received.
+// ThreadID is set from the thread_id query and Files hold the received content.
+func (s *Server) Messages() []messenger.Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]messenger.Message(nil), s.messages...)
+}
+
+// RateLimited returns the number of requests answered with 429.
+func (s *Server) RateLimited() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.rateLimited
+}
+
+// ServeHTTP implements the execute webhook endpoint.
+// https://discord.com/developers/docs/resources/webhook#execute-webhook
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	id, token, ok := parsePath(r.URL.Path)
+	switch {
+	case !ok:
+		writeError(w, http.StatusNotFound, 0, "404: Not Found", nil)
+		return
+	case id != WebhookID:
+		writeError(w, http.StatusNotFound, messenger.CodeUnknownWebhook, "Unknown Webhook", nil)
+		return
+	case token != WebhookToken:
+		writeError(w, http.StatusUnauthorized, messenger.CodeInvalidWebhookToken, "Invalid Webhook Token", nil)
+		return
+	case r.Method != http.MethodPost:
+		writeError(w, http.StatusMethodNotAllowed, 0, "405: Method Not Allowed", nil)
+		return
+	}
+
+	if !s.take(w, time.Now()) {
+		return
+	}
+
+	msg, err := readMessage(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, codeInvalidJSON, "The request body contains invalid JSON.", nil)
+		return
+	}
+	msg.ThreadID = r.URL.Query().Get("thread_id")
+	if err := validation.Message(msg); err != nil {
+		writeError(w, http.StatusBadRequest, messenger.CodeInvalidFormBody, "Invalid Form Body", fieldErrors(err))
+		return
+	}
+
+	created := s.record(msg)
+	if r.URL.Query().Get("wait") != "true" {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	writeJSON(w, http.StatusOK, created)
+}
+
+// parsePath parses /api[/v10]/webhooks/{id}/{token}.
+func parsePath(path string) (id, token string, ok bool) {
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+	if len(segments) == 0 || segments[0] != "api" {
+		return "", "", false
+	}
+	segments = segments[1:]
+	if len(segments) > 0 && strings.HasPrefix(segments[0], "v") {
+		segments = segments[1:]
+	}
+	if len(segments) != 3 || segments[0] != "webhooks" {
+		return "", "", false
+	}
+	return segments[1], segments[2], true
+}
+
+// take counts a request against the rate limit and sets the rate limit headers.
+// It answers 429 and returns false once the limit is exceeded.
+func (s *Server) take(w http.ResponseWriter, now time.Time) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !now.Before(s.reset) {
+		s.remaining = s.limit
+		// Headers have millisecond precision, rounding up never lets clients
+		// come back before the reset.
+		s.reset = now.Add(s.window).Truncate(time.Millisecond).Add(time.Millisecond)
+	}
+
+	resetAfter := math.Ceil(s.reset.Sub(now).Seconds()*1000) / 1000
+	h := w.Header()
+	h.Set("X-RateLimit-Bucket", "messengertest")
+	h.Set("X-RateLimit-Limit", strconv.Itoa(s.limit))
+	h.Set("X-RateLimit-Reset", strconv.FormatFloat(float64(s.reset.UnixMilli())/1000, 'f', 3, 64))
+	h.Set("X-RateLimit-Reset-After", strconv.FormatFloat(resetAfter, 'f', 3, 64))
+
+	if s.remaining > 0 {
+		s.remaining--
+		h.Set("X-RateLimit-Remaining", strconv.Itoa(s.remaining))
+		return true
+	}
+	s.rateLimited++
+	h.Set("X-RateLimit-Remaining", "0")
+	h.Set("X-RateLimit-Scope", "user")
+	h.Set("Retry-After", strconv.Itoa(int(math.Ceil(resetAfter))))
+	writeJSON(w, http.StatusTooManyRequests, map[string]interface{}{
+		"message":     "You are being rate limited.",
+		"retry_after": resetAfter,
+		"global":      false,
+	})
+	return false
+}
+
+// readMessage decodes the message of a JSON body, or of the payload_json part of
+// a multipart body along with its files.
+func readMessage(r *http.Request) (messenger.Message, error) {
+	var msg messenger.Message
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil {
+		return msg, err
+	}
+
+	switch mediaType {
+	case "application/json":
+		err = json.NewDecoder(r.Body).Decode(&msg)
+		return msg, err
+	case "multipart/form-data":
+		if err := r.ParseMultipartForm(32 << 20); err != nil {
+			return msg, err
+		}
+	default:
+		return msg, fmt.Errorf("unsupported content type %s", mediaType)
+	}
+
+	payload := r.MultipartForm.Value["payload_json"]
+	if len(payload) != 1 {
+		return msg, fmt.Errorf("payload_json is required")
+	}
+	if err := json.Unmarshal([]byte(payload[0]), &msg); err != nil {
+		return msg, err
+	}
+
+	names := make([]string, 0, len(r.MultipartForm.File))
+	for name := range r.MultipartForm.File {
+		names = append(names, name)
+	}
+	// Keep the order files were written in, file2 before file10.
+	sort.Slice(names, func(i, j int) bool {
+		if len(names[i]) != len(names[j]) {
+			return len(names[i]) < len(names[j])
+		}
+		return names[i] < names[j]
+	})
+	for _, name := range names {
+		for _, fh := range r.MultipartForm.File[name] {
+			f, err := fh.Open()
+			if err != nil {
+				return msg, err
+			}
+			data, err := io.ReadAll(f)
+			f.Close()
+			if err != nil {
+				return msg, err
+			}
+			msg.Files = append(msg.Files, &messenger.File{
+				Name:        fh.Filename,
+				ContentType: fh.Header.Get("Content-Type"),
+				Reader:      bytes.NewReader(data),
+			})
+		}
+	}
+	return msg, nil
+}
+
+// record stores msg and returns the message Discord would create for it.
+func (s *Server) record(msg messenger.Message) messenger.WebhookMessage {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.messages = append(s.messages, msg)
+
+	channelID := ChannelID
+	switch {
+	case msg.ThreadID != "":
+		channelID = msg.ThreadID
+	case msg.ThreadName != "":
+		channelID = s.nextID()
+	}
+	username := msg.Username
+	if username == "" {
+		username = "messengertest"
+	}
+	created := messenger.WebhookMessage{
+		ID:        s.nextID(),
+		ChannelID: channelID,
+		WebhookID: WebhookID,
+		Author:    messenger.User{ID: WebhookID, Username: username, Bot: true},
+		Content:   msg.Content,
+		Embeds:    msg.Embeds,
+		Timestamp: time.Now().UTC(),
+	}
+	for _, f := range msg.Files {
+		id := s.nextID()
+		created.Attachments = append(created.Attachments, messenger.Attachment{
+			ID:          id,
+			Filename:    f.Name,
+			ContentType: f.ContentType,
+			Size:        f.Reader.(*bytes.Reader).Len(),
+			URL:         s.URL + "/attachments/" + channelID + "/" + id + "/" + f.Name,
+		})
+	}
+	return created
+}
+
+func (s *Server) nextID() string {
+	s.lastID++
+	return strconv.FormatUint(s.lastID, 10)
+}
+
+// fieldPaths maps the prefixes of messenger validation errors to the fields
+// Discord reports them on.
+var fieldPaths = []struct {
+	prefix string
+	path   string
+}{
+	{"Message content", "content"},
+	{"Message embed", "embeds"},
+	{"Message flags", "flags"},
+	{"Message cannot have both thread", "thread_name"},
+	{"Thread name", "thread_name"},
+	{"Applied tag", "applied_tags"},
+	{"Allowed mention", "allowed_mentions"},
+	{"Embed", "embeds"},
+	{"Field", "embeds"},
+	{"Footer", "embeds"},
+}
+
+// fieldErrors returns the "errors" object of an Invalid Form Body response.
+func fieldErrors(err error) map[string]interface{} {
+	path := "content"
+	for _, p := range fieldPaths {
+		if strings.HasPrefix(err.Error(), p.prefix) {
+			path = p.path
+			break
+		}
+	}
+	return map[string]interface{}{
+		path: map[string]interface{}{
+			"_errors": []map[string]string{{"code": "BASE_TYPE_INVALID", "message": err.Error()}},
+		},
+	}
+}
+
+func writeError(w http.ResponseWriter, status, code int, message string, errs map[string]interface{}) {
+	body := map[string]interface{}{"code": code, "message": message}
+	if errs != nil {
+		body["errors"] = errs
+	}
+	writeJSON(w, status, body)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
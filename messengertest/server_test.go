@@ -0,0 +1,281 @@
+package messengertest
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/qiyihuang/messenger"
+	"github.com/stretchr/testify/require"
+)
+
+func newClient(t *testing.T, s *Server, opts ...messenger.Option) *messenger.Client {
+	c, err := messenger.NewClient(http.DefaultClient, s.WebhookURL(), append(opts, messenger.WithBaseURL(s.BaseURL()))...)
+	require.NoError(t, err, "New client failed")
+	return c
+}
+
+func post(t *testing.T, url, body string) *http.Response {
+	resp, err := http.Post(url, "application/json", strings.NewReader(body))
+	require.NoError(t, err, "Post failed")
+	t.Cleanup(func() { resp.Body.Close() })
+	return resp
+}
+
+func TestServerSend(t *testing.T) {
+	t.Run("JSON", func(t *testing.T) {
+		s := NewServer()
+		defer s.Close()
+		c := newClient(t, s)
+		msgs := []messenger.Message{
+			{Content: "1", Username: "alerts"},
+			{Embeds: []messenger.Embed{{Title: "2"}}, ThreadID: "300"},
+		}
+
+		results, err := c.Send(msgs)
+
+		require.NoError(t, err, "JSON failed")
+		require.Equal(t, http.StatusNoContent, results[0].StatusCode, "JSON failed")
+		require.Equal(t, DefaultRateLimit-2, results[1].RateLimit.Remaining, "JSON failed")
+		require.Equal(t, msgs, s.Messages(), "JSON failed")
+	})
+
+	t.Run("Multipart", func(t *testing.T) {
+		s := NewServer()
+		defer s.Close()
+		c := newClient(t, s, messenger.WithWait(true))
+		var files []*messenger.File
+		for _, name := range []string{"0.txt", "1.txt", "2.txt", "3.txt", "4.txt", "5.txt", "6.txt", "7.txt", "8.txt", "9.txt", "10.txt"} {
+			files = append(files, &messenger.File{Name: name, ContentType: "text/plain", Reader: strings.NewReader(name)})
+		}
+
+		results, err := c.Send([]messenger.Message{{Content: "logs", Files: files}})
+
+		require.NoError(t, err, "Multipart failed")
+		received := s.Messages()[0]
+		require.Equal(t, "logs", received.Content, "Multipart failed")
+		require.Len(t, received.Files, len(files), "Multipart failed")
+		for i, f := range received.Files {
+			data, _ := io.ReadAll(f.Reader)
+			require.Equal(t, files[i].Name, f.Name, "Multipart failed")
+			require.Equal(t, files[i].Name, string(data), "Multipart failed")
+			require.Equal(t, "text/plain", f.ContentType, "Multipart failed")
+		}
+		attachments := results[0].WebhookMessage.Attachments
+		require.Len(t, attachments, len(files), "Multipart failed")
+		require.Equal(t, "10.txt", attachments[10].Filename, "Multipart failed")
+		require.Equal(t, 6, attachments[10].Size, "Multipart failed")
+	})
+}
+
+func TestServerWait(t *testing.T) {
+	t.Run("Created message", func(t *testing.T) {
+		s := NewServer()
+		defer s.Close()
+		c := newClient(t, s, messenger.WithWait(true))
+
+		results, err := c.Send([]messenger.Message{{Content: "1"}, {Content: "2", Username: "alerts"}})
+
+		require.NoError(t, err, "Created message failed")
+		first, second := results[0].WebhookMessage, results[1].WebhookMessage
+		require.Equal(t, http.StatusOK, results[0].StatusCode, "Created message failed")
+		require.NotEqual(t, first.ID, second.ID, "Created message failed")
+		require.Equal(t, ChannelID, first.ChannelID, "Created message failed")
+		require.Equal(t, WebhookID, first.WebhookID, "Created message failed")
+		require.Equal(t, "1", first.Content, "Created message failed")
+		require.Equal(t, "alerts", second.Author.Username, "Created message failed")
+		require.True(t, second.Author.Bot, "Created message failed")
+		require.False(t, first.Timestamp.IsZero(), "Created message failed")
+	})
+
+	t.Run("Threads", func(t *testing.T) {
+		s := NewServer()
+		defer s.Close()
+		c := newClient(t, s, messenger.WithWait(true))
+
+		results, err := c.Send([]messenger.Message{{Content: "1", ThreadID: "300"}, {Content: "2", ThreadName: "Incident"}})
+
+		require.NoError(t, err, "Threads failed")
+		require.Equal(t, "300", results[0].WebhookMessage.ChannelID, "Threads failed")
+		require.NotEqual(t, ChannelID, results[1].WebhookMessage.ChannelID, "Threads failed")
+		require.Equal(t, "Incident", s.Messages()[1].ThreadName, "Threads failed")
+	})
+
+	t.Run("No wait", func(t *testing.T) {
+		s := NewServer()
+		defer s.Close()
+
+		resp := post(t, s.WebhookURL(), `{"content": "1"}`)
+
+		body, _ := io.ReadAll(resp.Body)
+		require.Equal(t, http.StatusNoContent, resp.StatusCode, "No wait failed")
+		require.Empty(t, body, "No wait failed")
+	})
+}
+
+func TestServerValidation(t *testing.T) {
+	invalid := []struct {
+		name string
+		body string
+		path string
+	}{
+		{"Empty", `{}`, "content"},
+		{"Content", `{"content": "` + strings.Repeat("a", messenger.MessageContentLimit+1) + `"}`, "content"},
+		{"Embed", `{"embeds": [{"title": "` + strings.Repeat("a", messenger.EmbedTitleLimit+1) + `"}]}`, "embeds"},
+		{"Thread name", `{"content": "1", "thread_name": "` + strings.Repeat("a", messenger.ThreadNameLimit+1) + `"}`, "thread_name"},
+		{"Flags", `{"content": "1", "flags": 1}`, "flags"},
+	}
+	for _, v := range invalid {
+		t.Run(v.name, func(t *testing.T) {
+			s := NewServer()
+			defer s.Close()
+
+			// Client would reject the message before sending it.
+			resp := post(t, s.WebhookURL(), v.body)
+
+			var body struct {
+				Code   int                                       `json:"code"`
+				Errors map[string]map[string][]map[string]string `json:"errors"`
+			}
+			json.NewDecoder(resp.Body).Decode(&body)
+			require.Equal(t, http.StatusBadRequest, resp.StatusCode, v.name+" failed")
+			require.Equal(t, messenger.CodeInvalidFormBody, body.Code, v.name+" failed")
+			require.Contains(t, body.Errors, v.path, v.name+" failed")
+			require.Empty(t, s.Messages(), v.name+" failed")
+		})
+	}
+
+	t.Run("Invalid JSON", func(t *testing.T) {
+		s := NewServer()
+		defer s.Close()
+
+		resp := post(t, s.WebhookURL(), `{"content":`)
+
+		require.Equal(t, http.StatusBadRequest, resp.StatusCode, "Invalid JSON failed")
+	})
+
+	t.Run("Content type", func(t *testing.T) {
+		s := NewServer()
+		defer s.Close()
+
+		resp, err := http.Post(s.WebhookURL(), "text/plain", strings.NewReader("1"))
+
+		require.NoError(t, err, "Content type failed")
+		resp.Body.Close()
+		require.Equal(t, http.StatusBadRequest, resp.StatusCode, "Content type failed")
+	})
+}
+
+func TestServerWebhook(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+	invalid := []struct {
+		name   string
+		method string
+		url    string
+		status int
+		code   int
+	}{
+		{"Path", http.MethodPost, s.URL + "/api/channels/1", http.StatusNotFound, 0},
+		{"Unknown webhook", http.MethodPost, s.BaseURL() + "/webhooks/1/" + WebhookToken, http.StatusNotFound, messenger.CodeUnknownWebhook},
+		{"Invalid token", http.MethodPost, s.BaseURL() + "/webhooks/" + WebhookID + "/token", http.StatusUnauthorized, messenger.CodeInvalidWebhookToken},
+		{"Method", http.MethodGet, s.WebhookURL(), http.StatusMethodNotAllowed, 0},
+	}
+	for _, v := range invalid {
+		t.Run(v.name, func(t *testing.T) {
+			req, _ := http.NewRequest(v.method, v.url, bytes.NewBufferString(`{"content": "1"}`))
+			req.Header.Set("Content-Type", "application/json")
+
+			resp, err := http.DefaultClient.Do(req)
+
+			require.NoError(t, err, v.name+" failed")
+			defer resp.Body.Close()
+			var body struct {
+				Code int `json:"code"`
+			}
+			json.NewDecoder(resp.Body).Decode(&body)
+			require.Equal(t, v.status, resp.StatusCode, v.name+" failed")
+			require.Equal(t, v.code, body.Code, v.name+" failed")
+		})
+	}
+
+	t.Run("Versioned", func(t *testing.T) {
+		resp := post(t, s.BaseURL()+"/v10/webhooks/"+WebhookID+"/"+WebhookToken, `{"content": "1"}`)
+
+		require.Equal(t, http.StatusNoContent, resp.StatusCode, "Versioned failed")
+	})
+}
+
+func TestServerRateLimit(t *testing.T) {
+	t.Run("429", func(t *testing.T) {
+		s := NewServer(WithRateLimit(2, time.Second))
+		defer s.Close()
+
+		first := post(t, s.WebhookURL(), `{"content": "1"}`)
+		post(t, s.WebhookURL(), `{"content": "2"}`)
+		limited := post(t, s.WebhookURL(), `{"content": "3"}`)
+
+		require.Equal(t, "2", first.Header.Get("X-RateLimit-Limit"), "429 failed")
+		require.Equal(t, "1", first.Header.Get("X-RateLimit-Remaining"), "429 failed")
+		require.Equal(t, "messengertest", first.Header.Get("X-RateLimit-Bucket"), "429 failed")
+		require.NotEmpty(t, first.Header.Get("X-RateLimit-Reset"), "429 failed")
+		require.NotEmpty(t, first.Header.Get("X-RateLimit-Reset-After"), "429 failed")
+		require.Equal(t, http.StatusTooManyRequests, limited.StatusCode, "429 failed")
+		require.Equal(t, "0", limited.Header.Get("X-RateLimit-Remaining"), "429 failed")
+		require.Equal(t, "user", limited.Header.Get("X-RateLimit-Scope"), "429 failed")
+		require.NotEmpty(t, limited.Header.Get("Retry-After"), "429 failed")
+		var body struct {
+			RetryAfter float64 `json:"retry_after"`
+			Global     bool    `json:"global"`
+		}
+		json.NewDecoder(limited.Body).Decode(&body)
+		require.Greater(t, body.RetryAfter, 0.0, "429 failed")
+		require.LessOrEqual(t, body.RetryAfter, 1.001, "429 failed")
+		require.False(t, body.Global, "429 failed")
+		require.Len(t, s.Messages(), 2, "429 failed")
+		require.Equal(t, 1, s.RateLimited(), "429 failed")
+	})
+
+	t.Run("Reset", func(t *testing.T) {
+		s := NewServer(WithRateLimit(1, 50*time.Millisecond))
+		defer s.Close()
+
+		post(t, s.WebhookURL(), `{"content": "1"}`)
+		time.Sleep(60 * time.Millisecond)
+		resp := post(t, s.WebhookURL(), `{"content": "2"}`)
+
+		require.Equal(t, http.StatusNoContent, resp.StatusCode, "Reset failed")
+	})
+
+	t.Run("Client follows headers", func(t *testing.T) {
+		s := NewServer(WithRateLimit(2, 100*time.Millisecond))
+		defer s.Close()
+		c := newClient(t, s)
+		msgs := []messenger.Message{{Content: "1"}, {Content: "2"}, {Content: "3"}, {Content: "4"}, {Content: "5"}}
+
+		start := time.Now()
+		_, err := c.Send(msgs)
+
+		require.NoError(t, err, "Client follows headers failed")
+		require.GreaterOrEqual(t, time.Since(start), 200*time.Millisecond, "Client follows headers failed")
+		require.Len(t, s.Messages(), len(msgs), "Client follows headers failed")
+		require.Zero(t, s.RateLimited(), "Client follows headers failed")
+	})
+
+	t.Run("Client retries", func(t *testing.T) {
+		s := NewServer(WithRateLimit(1, 100*time.Millisecond))
+		defer s.Close()
+		c := newClient(t, s)
+		post(t, s.WebhookURL(), `{"content": "other client"}`)
+
+		results, err := c.Send([]messenger.Message{{Content: "1"}})
+
+		require.NoError(t, err, "Client retries failed")
+		require.Equal(t, 2, results[0].Attempts, "Client retries failed")
+		require.Equal(t, 1, s.RateLimited(), "Client retries failed")
+	})
+}
@@ -0,0 +1,25 @@
+package messenger
+
+// notifier wakes up the goroutines waiting for a change of a state guarded by
+// a mutex, which must be held when calling its methods. Waiting on a channel
+// rather than a sync.Cond lets waits end with a context. The zero value is
+// ready to use.
+type notifier struct {
+	ch chan struct{}
+}
+
+// wait returns a channel closed by the next broadcast.
+func (n *notifier) wait() <-chan struct{} {
+	if n.ch == nil {
+		n.ch = make(chan struct{})
+	}
+	return n.ch
+}
+
+// broadcast wakes up everything waiting for a change.
+func (n *notifier) broadcast() {
+	if n.ch != nil {
+		close(n.ch)
+		n.ch = nil
+	}
+}
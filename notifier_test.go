@@ -0,0 +1,33 @@
+package messenger
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNotifier(t *testing.T) {
+	t.Run("Broadcast", func(t *testing.T) {
+		var n notifier
+		first, second := n.wait(), n.wait()
+
+		n.broadcast()
+
+		require.Equal(t, first, second, "Broadcast failed")
+		_, open := <-first
+		require.False(t, open, "Broadcast failed")
+		require.NotEqual(t, first, n.wait(), "Broadcast failed")
+	})
+
+	t.Run("Without waiters", func(t *testing.T) {
+		var n notifier
+
+		n.broadcast()
+
+		select {
+		case <-n.wait():
+			t.Fatal("Without waiters failed")
+		default:
+		}
+	})
+}
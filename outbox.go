@@ -0,0 +1,606 @@
+package messenger
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Defaults of an Outbox.
+const (
+	DefaultSegmentSize   = 4 << 20
+	DefaultRetryInterval = 5 * time.Second
+)
+
+// ErrOutboxClosed is returned by Outbox methods called after Close.
+var ErrOutboxClosed = errors.New("outbox is closed")
+
+const (
+	segmentExt = ".seg"
+	// Records larger than that are treated as corrupted.
+	maxRecordSize = 1 << 30
+)
+
+// OutboxOption configures an Outbox.
+type OutboxOption func(*Outbox)
+
+// WithSegmentSize sets the size from which a new segment file is started.
+// Segments are deleted once all of their messages are sent.
+func WithSegmentSize(n int64) OutboxOption {
+	return func(o *Outbox) {
+		o.segmentSize = n
+	}
+}
+
+// WithRetryInterval sets the wait before sending again a message which failed
+// with a network, rate limit or server error.
+func WithRetryInterval(d time.Duration) OutboxOption {
+	return func(o *Outbox) {
+		o.retryInterval = d
+	}
+}
+
+// WithOutboxErrorHandler sets the function called with every message which
+// cannot be sent, see OutboxStats.Rejected, which is removed from the Outbox.
+// It runs on the goroutine of the Outbox.
+func WithOutboxErrorHandler(f func(msg Message, err error)) OutboxOption {
+	return func(o *Outbox) {
+		o.onError = f
+	}
+}
+
+// OutboxStats counts the messages of an Outbox.
+type OutboxStats struct {
+	// Pending is the number of messages stored and not sent yet.
+	Pending int
+	Sent    uint64
+	// Rejected is the number of messages which cannot be sent: rejected by
+	// Discord, failing validation or failing with an error other than a
+	// network, rate limit or server error. They are removed, passed to the
+	// error handler and put into the dead letter sink of the Client.
+	Rejected uint64
+	// Retries is the number of failed attempts to be retried.
+	Retries uint64
+	// Corrupted is the number of segments found corrupted when opening the
+	// Outbox, the records following the corruption in them are lost.
+	Corrupted int
+}
+
+// Outbox stores messages in a directory before sending them with a Client, so
+// that messages survive restarts of the process. Messages are sent in order
+// and removed once sent, those left are sent again when the Outbox is opened.
+// Delivery is at least once: a message whose removal was not stored before a
+// crash is sent again. The progress of messages divided into several is stored
+// too, the divided messages delivered are not sent again.
+type Outbox struct {
+	dir           string
+	client        *Client
+	segmentSize   int64
+	retryInterval time.Duration
+	onError       func(msg Message, err error)
+
+	mu       sync.Mutex
+	pending  []outboxEntry
+	segments []segment // Oldest first, the last one is written to.
+	file     segmentFile
+	size     int64 // Size of file up to its last whole record.
+	seq      uint64
+	closed   bool
+	stats    OutboxStats
+	changed  notifier
+
+	stop       context.CancelFunc // Stops waiting between retries.
+	stopCtx    context.Context
+	cancelSend context.CancelFunc // Cancels the message being sent.
+	sendCtx    context.Context
+	done       chan struct{} // Closed when the worker returns.
+}
+
+type outboxEntry struct {
+	seq uint64
+	msg Message
+	// sent is the number of messages divided from msg stored as delivered,
+	// threadID the post they created, if any.
+	sent     int
+	threadID string
+	// partial holds the messages left to send after a failure, nil before.
+	partial *PartialSendError
+}
+
+// segmentFile is the file of the segment written to, an *os.File opened for
+// appending.
+type segmentFile interface {
+	io.Writer
+	Sync() error
+	Truncate(size int64) error
+	Close() error
+}
+
+// segment is a file of the log.
+type segment struct {
+	num    uint64
+	maxSeq uint64 // Largest sequence number of the messages in the segment, 0 without.
+}
+
+// outboxRecord is a record of the log, either a message, the removal of one or
+// the number of messages divided from one which were delivered.
+type outboxRecord struct {
+	Seq      uint64         `json:"seq"`
+	Ack      bool           `json:"ack,omitempty"`
+	Message  *outboxMessage `json:"message,omitempty"`
+	Sent     int            `json:"sent,omitempty"`
+	ThreadID string         `json:"thread_id,omitempty"`
+}
+
+// outboxMessage holds the fields of Message left out of its JSON.
+type outboxMessage struct {
+	Message  Message      `json:"message"`
+	ThreadID string       `json:"thread_id,omitempty"`
+	DedupKey string       `json:"dedup_key,omitempty"`
+	Files    []outboxFile `json:"files,omitempty"`
+}
+
+type outboxFile struct {
+	Name        string `json:"name"`
+	ContentType string `json:"content_type,omitempty"`
+	Data        []byte `json:"data"`
+}
+
+// OpenOutbox opens the Outbox stored in dir, created if missing, and starts
+// sending its messages with c. It must be closed with Close.
+func OpenOutbox(dir string, c *Client, opts ...OutboxOption) (*Outbox, error) {
+	o := &Outbox{
+		dir:           dir,
+		client:        c,
+		segmentSize:   DefaultSegmentSize,
+		retryInterval: DefaultRetryInterval,
+		done:          make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	if err := o.replay(); err != nil {
+		return nil, err
+	}
+	// Never append to a segment which may end with a partial record.
+	if err := o.rotate(); err != nil {
+		return nil, err
+	}
+	o.compact()
+
+	o.stopCtx, o.stop = context.WithCancel(context.Background())
+	o.sendCtx, o.cancelSend = context.WithCancel(context.Background())
+	go o.run()
+	return o, nil
+}
+
+// Add stores msg and returns once it is on disk. msg is validated and its files
+// are read before.
+func (o *Outbox) Add(msg Message) error {
+	if err := validateMessages(o.client.divide([]Message{msg})); err != nil {
+		return err
+	}
+	buffered, err := bufferFiles([]Message{msg})
+	if err != nil {
+		return err
+	}
+	msg = buffered[0]
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.closed {
+		return ErrOutboxClosed
+	}
+	if o.size >= o.segmentSize {
+		if err := o.rotate(); err != nil {
+			return err
+		}
+	}
+	seq := o.seq + 1
+	if err := o.write(outboxRecord{Seq: seq, Message: encodeOutboxMessage(msg)}); err != nil {
+		return err
+	}
+	o.seq = seq
+	o.segments[len(o.segments)-1].maxSeq = seq
+	o.pending = append(o.pending, outboxEntry{seq: seq, msg: msg})
+	o.changed.broadcast()
+	return nil
+}
+
+// Flush waits until the messages added before the call are sent or rejected.
+func (o *Outbox) Flush(ctx context.Context) error {
+	o.mu.Lock()
+	target := o.seq
+	for len(o.pending) > 0 && o.pending[0].seq <= target {
+		if o.closed {
+			o.mu.Unlock()
+			return ErrOutboxClosed
+		}
+		changed := o.changed.wait()
+		o.mu.Unlock()
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		o.mu.Lock()
+	}
+	o.mu.Unlock()
+	return nil
+}
+
+// Close stops sending and closes the files of the Outbox, the messages not sent
+// stay stored. It waits for the message being sent, which is cancelled when
+// ctx is done first and then sent again when the Outbox is opened.
+func (o *Outbox) Close(ctx context.Context) error {
+	o.mu.Lock()
+	if o.closed {
+		o.mu.Unlock()
+		<-o.done
+		return nil
+	}
+	o.closed = true
+	o.changed.broadcast()
+	o.mu.Unlock()
+	o.stop()
+
+	var err error
+	select {
+	case <-o.done:
+	case <-ctx.Done():
+		o.cancelSend()
+		<-o.done
+		err = ctx.Err()
+	}
+	o.cancelSend()
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if closeErr := o.file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// Stats returns the counters of the Outbox.
+func (o *Outbox) Stats() OutboxStats {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	stats := o.stats
+	stats.Pending = len(o.pending)
+	return stats
+}
+
+// run sends the pending messages in order until the Outbox is closed.
+func (o *Outbox) run() {
+	defer close(o.done)
+	for {
+		o.mu.Lock()
+		for len(o.pending) == 0 && !o.closed {
+			changed := o.changed.wait()
+			o.mu.Unlock()
+			<-changed
+			o.mu.Lock()
+		}
+		if o.closed {
+			o.mu.Unlock()
+			return
+		}
+		entry := o.pending[0]
+		o.mu.Unlock()
+
+		err := o.send(entry)
+		var partial *PartialSendError
+		if errors.As(err, &partial) && len(partial.Pending) == 0 {
+			// The last message was delivered, the error came after.
+			err, partial = nil, nil
+		}
+		if partial != nil && retryable(partial.Err) {
+			o.mu.Lock()
+			o.progress(partial)
+			if o.sendCtx.Err() != nil {
+				o.mu.Unlock()
+				return
+			}
+			o.stats.Retries++
+			o.mu.Unlock()
+			if sleep(o.stopCtx, o.retryInterval) != nil {
+				return
+			}
+			continue
+		}
+		if partial != nil && !rejected(partial.Err) {
+			// Rejected and invalid messages are already put by the Client.
+			o.client.putDeadLetter(o.sendCtx, partial.Pending[0], &entry.msg, partial.Err)
+		}
+
+		o.mu.Lock()
+		// A failed write only means the message may be sent again.
+		o.write(outboxRecord{Seq: entry.seq, Ack: true})
+		o.pending = o.pending[1:]
+		if err != nil {
+			o.stats.Rejected++
+		} else {
+			o.stats.Sent++
+		}
+		o.compact()
+		o.changed.broadcast()
+		o.mu.Unlock()
+		if err != nil && o.onError != nil {
+			o.onError(entry.msg, err)
+		}
+	}
+}
+
+// send sends the message of entry, resuming after the messages divided from it
+// which were delivered. Errors other than *PartialSendError mean the message
+// is invalid.
+func (o *Outbox) send(entry outboxEntry) error {
+	partial := entry.partial
+	if partial == nil && entry.sent > 0 {
+		var err error
+		if partial, err = o.client.resumeFrom(o.sendCtx, entry.msg, entry.sent, entry.threadID); err != nil {
+			return err
+		}
+	}
+	if partial == nil {
+		_, err := o.client.SendContext(o.sendCtx, []Message{entry.msg})
+		return err
+	}
+	_, err := o.client.Resume(o.sendCtx, partial)
+	return err
+}
+
+// progress keeps partial to resume the first pending message from it, and
+// stores the messages divided from it which were delivered. o.mu must be held.
+func (o *Outbox) progress(partial *PartialSendError) {
+	entry := &o.pending[0]
+	entry.partial = partial
+	if partial.Index <= entry.sent {
+		return
+	}
+	entry.sent = partial.Index
+	// The following messages are posted in the post created by the first one.
+	if entry.msg.ThreadName != "" && len(partial.Pending) > 0 {
+		entry.threadID = partial.Pending[0].ThreadID
+	}
+	// A failed write only means the delivered messages may be sent again.
+	o.write(outboxRecord{Seq: entry.seq, Sent: entry.sent, ThreadID: entry.threadID})
+}
+
+// retryable reports whether sending again may succeed after err: the request
+// failed, or Discord rate limited it or failed.
+func retryable(err error) bool {
+	var netErr net.Error
+	var urlErr *url.Error
+	var limitErr *RateLimitError
+	var apiErr *APIError
+	switch {
+	case errors.As(err, &netErr), errors.As(err, &urlErr), errors.As(err, &limitErr):
+		return true
+	case errors.As(err, &apiErr):
+		return apiErr.StatusCode >= http.StatusInternalServerError || apiErr.StatusCode == http.StatusTooManyRequests
+	}
+	return errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)
+}
+
+// rejected reports whether err is Discord refusing the message, which would
+// fail again if sent again.
+func rejected(err error) bool {
+	var apiErr *APIError
+	return errors.As(err, &apiErr) && apiErr.StatusCode >= http.StatusBadRequest &&
+		apiErr.StatusCode < http.StatusInternalServerError && apiErr.StatusCode != http.StatusTooManyRequests
+}
+
+// replay reads the segments of dir into the pending messages.
+func (o *Outbox) replay() error {
+	entries, err := os.ReadDir(o.dir)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasSuffix(name, segmentExt) {
+			continue
+		}
+		num, err := strconv.ParseUint(strings.TrimSuffix(name, segmentExt), 10, 64)
+		if err != nil {
+			continue
+		}
+		o.segments = append(o.segments, segment{num: num})
+	}
+	sort.Slice(o.segments, func(i, j int) bool { return o.segments[i].num < o.segments[j].num })
+
+	acked := make(map[uint64]bool)
+	progress := make(map[uint64]outboxRecord)
+	var msgs []outboxEntry
+	for i := range o.segments {
+		s := &o.segments[i]
+		corrupted, err := o.readSegment(s, func(r outboxRecord) {
+			if r.Seq > o.seq {
+				o.seq = r.Seq
+			}
+			if r.Ack {
+				acked[r.Seq] = true
+				return
+			}
+			if r.Message == nil {
+				progress[r.Seq] = r
+				return
+			}
+			s.maxSeq = r.Seq
+			msgs = append(msgs, outboxEntry{seq: r.Seq, msg: r.Message.decode()})
+		})
+		if err != nil {
+			return err
+		}
+		if corrupted {
+			o.stats.Corrupted++
+		}
+	}
+	for _, m := range msgs {
+		if acked[m.seq] {
+			continue
+		}
+		if p, ok := progress[m.seq]; ok {
+			m.sent, m.threadID = p.Sent, p.ThreadID
+		}
+		o.pending = append(o.pending, m)
+	}
+	return nil
+}
+
+// readSegment calls f with each record of s. It stops at the first corrupted
+// record and reports it.
+func (o *Outbox) readSegment(s *segment, f func(outboxRecord)) (corrupted bool, err error) {
+	file, err := os.Open(o.segmentPath(s.num))
+	if err != nil {
+		return false, err
+	}
+	defer file.Close()
+
+	r := bufio.NewReader(file)
+	for {
+		payload, err := readFrame(r)
+		if err == io.EOF {
+			return false, nil
+		}
+		if err != nil {
+			return true, nil
+		}
+		var rec outboxRecord
+		if json.Unmarshal(payload, &rec) != nil || rec.Seq == 0 || (!rec.Ack && rec.Message == nil && rec.Sent == 0) {
+			return true, nil
+		}
+		f(rec)
+	}
+}
+
+// readFrame reads a record framed as its length and CRC-32 followed by it.
+// io.EOF is only returned at the end of the last complete record.
+func readFrame(r io.Reader) ([]byte, error) {
+	var header [8]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		if err == io.EOF {
+			return nil, io.EOF
+		}
+		return nil, fmt.Errorf("truncated record header: %w", err)
+	}
+	size := binary.BigEndian.Uint32(header[:4])
+	if size > maxRecordSize {
+		return nil, errors.New("invalid record size")
+	}
+	payload := make([]byte, size)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return nil, fmt.Errorf("truncated record: %w", err)
+	}
+	if crc32.ChecksumIEEE(payload) != binary.BigEndian.Uint32(header[4:]) {
+		return nil, errors.New("record checksum mismatch")
+	}
+	return payload, nil
+}
+
+// write appends rec to the current segment and syncs it to disk.
+func (o *Outbox) write(rec outboxRecord) error {
+	// Marshal would never fail since records only hold messages.
+	payload, _ := json.Marshal(rec)
+	frame := make([]byte, 8+len(payload))
+	binary.BigEndian.PutUint32(frame[:4], uint32(len(payload)))
+	binary.BigEndian.PutUint32(frame[4:8], crc32.ChecksumIEEE(payload))
+	copy(frame[8:], payload)
+
+	_, err := o.file.Write(frame)
+	if err == nil {
+		err = o.file.Sync()
+	}
+	if err != nil {
+		// Records after a partly written one could not be read back, it is
+		// cut off or the following records go to a new segment.
+		if o.file.Truncate(o.size) != nil {
+			o.rotate()
+		}
+		return err
+	}
+	o.size += int64(len(frame))
+	return nil
+}
+
+// rotate starts a new segment.
+func (o *Outbox) rotate() error {
+	var num uint64 = 1
+	if len(o.segments) > 0 {
+		num = o.segments[len(o.segments)-1].num + 1
+	}
+	file, err := os.OpenFile(o.segmentPath(num), os.O_CREATE|os.O_EXCL|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return err
+	}
+	if o.file != nil {
+		o.file.Close()
+	}
+	o.file, o.size = file, 0
+	o.segments = append(o.segments, segment{num: num})
+	return nil
+}
+
+// compact deletes the oldest segments whose messages are all sent. Messages
+// are sent in order, so it is the case for the segments whose messages are
+// older than the first pending one.
+func (o *Outbox) compact() {
+	for len(o.segments) > 1 {
+		s := o.segments[0]
+		if len(o.pending) > 0 && s.maxSeq >= o.pending[0].seq {
+			return
+		}
+		if err := os.Remove(o.segmentPath(s.num)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return
+		}
+		o.segments = o.segments[1:]
+	}
+}
+
+func (o *Outbox) segmentPath(num uint64) string {
+	return filepath.Join(o.dir, fmt.Sprintf("%020d%s", num, segmentExt))
+}
+
+// encodeOutboxMessage converts msg, whose files are buffered, for storage.
+func encodeOutboxMessage(msg Message) *outboxMessage {
+	m := &outboxMessage{Message: msg, ThreadID: msg.ThreadID, DedupKey: msg.DedupKey}
+	for _, f := range msg.Files {
+		m.Files = append(m.Files, outboxFile{Name: f.Name, ContentType: f.ContentType, Data: f.data})
+	}
+	return m
+}
+
+func (m *outboxMessage) decode() Message {
+	msg := m.Message
+	msg.ThreadID = m.ThreadID
+	msg.DedupKey = m.DedupKey
+	for _, f := range m.Files {
+		data := f.Data
+		if data == nil {
+			data = []byte{}
+		}
+		msg.Files = append(msg.Files, &File{Name: f.Name, ContentType: f.ContentType, Reader: bytes.NewReader(data), data: data})
+	}
+	return msg
+}
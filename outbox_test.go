@@ -0,0 +1,511 @@
+package messenger
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// unreachableClient fails to send, messages stay in the Outbox.
+func unreachableClient() *Client {
+	server := httptest.NewServer(http.NotFoundHandler())
+	server.Close()
+	return &Client{url: server.URL, client: http.DefaultClient, maxAttempts: 1}
+}
+
+func segmentFiles(t *testing.T, dir string) []string {
+	files, err := filepath.Glob(filepath.Join(dir, "*"+segmentExt))
+	require.NoError(t, err, "Glob failed")
+	return files
+}
+
+func outboxEmbeds(n int) []Embed {
+	embeds := make([]Embed, n)
+	for i := range embeds {
+		embeds[i] = Embed{Title: "embed"}
+	}
+	return embeds
+}
+
+func TestOutbox(t *testing.T) {
+	t.Run("Send", func(t *testing.T) {
+		server := newTestServer(nil)
+		defer server.Close()
+		o, err := OpenOutbox(t.TempDir(), server.client())
+		require.NoError(t, err, "Send failed")
+		defer o.Close(context.Background())
+
+		require.NoError(t, o.Add(Message{Content: "1"}), "Send failed")
+		require.NoError(t, o.Add(Message{Content: "2"}), "Send failed")
+		err = o.Flush(context.Background())
+
+		require.NoError(t, err, "Send failed")
+		require.Equal(t, []string{`{"content":"1"}`, `{"content":"2"}`}, server.Bodies(), "Send failed")
+		require.Equal(t, OutboxStats{Sent: 2}, o.Stats(), "Send failed")
+	})
+
+	t.Run("Replay", func(t *testing.T) {
+		dir := t.TempDir()
+		o, _ := OpenOutbox(dir, unreachableClient(), WithRetryInterval(time.Hour))
+		msg := Message{
+			Content:  "1",
+			ThreadID: "300",
+			Files:    []*File{{Name: "a.txt", ContentType: "text/plain", Reader: strings.NewReader("file")}},
+		}
+		require.NoError(t, o.Add(msg), "Replay failed")
+		require.NoError(t, o.Add(Message{Content: "2"}), "Replay failed")
+		require.NoError(t, o.Close(context.Background()), "Replay failed")
+		server := newTestServer(nil)
+		defer server.Close()
+
+		o, err := OpenOutbox(dir, server.client())
+		require.NoError(t, err, "Replay failed")
+		defer o.Close(context.Background())
+		require.NoError(t, o.Flush(context.Background()), "Replay failed")
+
+		bodies := server.Bodies()
+		require.Len(t, bodies, 2, "Replay failed")
+		require.Contains(t, bodies[0], "file", "Replay failed")
+		require.Equal(t, "thread_id=300", server.Queries()[0], "Replay failed")
+		require.Equal(t, `{"content":"2"}`, bodies[1], "Replay failed")
+	})
+
+	t.Run("Sent not replayed", func(t *testing.T) {
+		dir := t.TempDir()
+		server := newTestServer(nil)
+		defer server.Close()
+		o, _ := OpenOutbox(dir, server.client())
+		o.Add(Message{Content: "1"})
+		o.Flush(context.Background())
+		o.Close(context.Background())
+
+		o, err := OpenOutbox(dir, server.client())
+		require.NoError(t, err, "Sent not replayed failed")
+		defer o.Close(context.Background())
+
+		require.NoError(t, o.Flush(context.Background()), "Sent not replayed failed")
+		require.Len(t, server.Bodies(), 1, "Sent not replayed failed")
+		require.Equal(t, OutboxStats{}, o.Stats(), "Sent not replayed failed")
+	})
+
+	t.Run("Retry", func(t *testing.T) {
+		server := newTestServer(nil, http.StatusInternalServerError)
+		defer server.Close()
+		o, _ := OpenOutbox(t.TempDir(), server.client(), WithRetryInterval(time.Millisecond))
+		defer o.Close(context.Background())
+
+		o.Add(Message{Content: "1"})
+		err := o.Flush(context.Background())
+
+		require.NoError(t, err, "Retry failed")
+		require.Len(t, server.Bodies(), 1, "Retry failed")
+		require.Equal(t, OutboxStats{Sent: 1, Retries: 1}, o.Stats(), "Retry failed")
+	})
+
+	t.Run("Partial send", func(t *testing.T) {
+		server := newTestServer(nil, http.StatusNoContent, http.StatusInternalServerError)
+		defer server.Close()
+		o, _ := OpenOutbox(t.TempDir(), server.client(), WithRetryInterval(time.Millisecond))
+		defer o.Close(context.Background())
+
+		o.Add(Message{Embeds: outboxEmbeds(MessageEmbedNumLimit + 1)})
+		err := o.Flush(context.Background())
+
+		require.NoError(t, err, "Partial send failed")
+		require.Len(t, server.received, 3, "Partial send failed")
+		bodies := server.Bodies()
+		require.Len(t, bodies, 2, "Partial send failed")
+		require.Equal(t, MessageEmbedNumLimit, strings.Count(bodies[0], `"title"`), "Partial send failed")
+		require.Equal(t, 1, strings.Count(bodies[1], `"title"`), "Partial send failed")
+		require.Equal(t, OutboxStats{Sent: 1, Retries: 1}, o.Stats(), "Partial send failed")
+	})
+
+	t.Run("Partial send replayed", func(t *testing.T) {
+		dir := t.TempDir()
+		failing := newTestServer(nil, http.StatusNoContent, http.StatusInternalServerError)
+		defer failing.Close()
+		o, _ := OpenOutbox(dir, failing.client(), WithRetryInterval(time.Hour))
+		o.Add(Message{Embeds: outboxEmbeds(MessageEmbedNumLimit + 1)})
+		require.Eventually(t, func() bool { return o.Stats().Retries == 1 }, time.Second, time.Millisecond, "Partial send replayed failed")
+		o.Close(context.Background())
+		server := newTestServer(nil)
+		defer server.Close()
+
+		o, err := OpenOutbox(dir, server.client())
+		require.NoError(t, err, "Partial send replayed failed")
+		defer o.Close(context.Background())
+		require.NoError(t, o.Flush(context.Background()), "Partial send replayed failed")
+
+		bodies := server.Bodies()
+		require.Len(t, bodies, 1, "Partial send replayed failed")
+		require.Equal(t, 1, strings.Count(bodies[0], `"title"`), "Partial send replayed failed")
+	})
+
+	t.Run("Delivered then failed", func(t *testing.T) {
+		var count int
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			count++
+			w.Header().Set("x-ratelimit-remaining", "a")
+			w.WriteHeader(http.StatusNoContent)
+		}))
+		defer server.Close()
+		c := &Client{url: server.URL, client: http.DefaultClient, limiter: &HeaderRateLimiter{}, maxAttempts: 1}
+		sink := &MemoryDeadLetters{}
+		WithDeadLetters(sink)(c)
+		o, _ := OpenOutbox(t.TempDir(), c, WithRetryInterval(time.Hour))
+		defer o.Close(context.Background())
+
+		o.Add(Message{Content: "1"})
+		o.Add(Message{Content: "2"})
+		err := o.Flush(context.Background())
+
+		require.NoError(t, err, "Delivered then failed failed")
+		require.Equal(t, 2, count, "Delivered then failed failed")
+		require.Equal(t, OutboxStats{Sent: 2}, o.Stats(), "Delivered then failed failed")
+		require.Empty(t, sink.Letters(), "Delivered then failed failed")
+	})
+
+	t.Run("Rejected", func(t *testing.T) {
+		server := newTestServer(nil, http.StatusBadRequest)
+		defer server.Close()
+		var rejectedErr error
+		o, _ := OpenOutbox(t.TempDir(), server.client(), WithOutboxErrorHandler(func(msg Message, err error) {
+			rejectedErr = err
+		}))
+		defer o.Close(context.Background())
+
+		o.Add(Message{Content: "1"})
+		o.Add(Message{Content: "2"})
+		err := o.Flush(context.Background())
+
+		var apiErr *APIError
+		require.NoError(t, err, "Rejected failed")
+		require.ErrorAs(t, rejectedErr, &apiErr, "Rejected failed")
+		require.Equal(t, []string{`{"content":"2"}`}, server.Bodies(), "Rejected failed")
+		require.Equal(t, OutboxStats{Sent: 1, Rejected: 1}, o.Stats(), "Rejected failed")
+	})
+
+	t.Run("Cannot be sent", func(t *testing.T) {
+		dir := t.TempDir()
+		split := unreachableClient()
+		WithSplitContent(true)(split)
+		o, _ := OpenOutbox(dir, split, WithRetryInterval(time.Hour))
+		o.Add(Message{Content: strings.Repeat("a", MessageContentLimit+1)})
+		o.Add(Message{Content: "next"})
+		o.Close(context.Background())
+		server := newTestServer(nil)
+		defer server.Close()
+		sink := &MemoryDeadLetters{}
+		c := server.client()
+		WithDeadLetters(sink)(c)
+		var handledErr error
+
+		// The Client no longer splits content, the first message fails
+		// validation on every attempt.
+		o, err := OpenOutbox(dir, c, WithRetryInterval(time.Hour), WithOutboxErrorHandler(func(msg Message, err error) {
+			handledErr = err
+		}))
+		require.NoError(t, err, "Cannot be sent failed")
+		defer o.Close(context.Background())
+		err = o.Flush(context.Background())
+
+		require.NoError(t, err, "Cannot be sent failed")
+		require.Error(t, handledErr, "Cannot be sent failed")
+		require.Equal(t, []string{"next"}, server.Contents(), "Cannot be sent failed")
+		require.Equal(t, OutboxStats{Sent: 1, Rejected: 1}, o.Stats(), "Cannot be sent failed")
+		require.Len(t, sink.Letters(), 1, "Cannot be sent failed")
+	})
+
+	t.Run("Unknown error", func(t *testing.T) {
+		sink := &MemoryDeadLetters{}
+		c := &Client{url: "https://discord.com/api/webhooks/123/token", client: &sequenceHttpClient{plain: true}, maxAttempts: 1}
+		WithDeadLetters(sink)(c)
+		o, _ := OpenOutbox(t.TempDir(), c, WithRetryInterval(time.Hour))
+		defer o.Close(context.Background())
+
+		o.Add(Message{Content: "1"})
+		o.Add(Message{Content: "2"})
+		err := o.Flush(context.Background())
+
+		require.NoError(t, err, "Unknown error failed")
+		require.Equal(t, OutboxStats{Sent: 1, Rejected: 1}, o.Stats(), "Unknown error failed")
+		letters := sink.Letters()
+		require.Len(t, letters, 1, "Unknown error failed")
+		require.Equal(t, "2", letters[0].Message.Content, "Unknown error failed")
+	})
+
+	t.Run("Invalid message", func(t *testing.T) {
+		o, _ := OpenOutbox(t.TempDir(), unreachableClient())
+		defer o.Close(context.Background())
+
+		err := o.Add(Message{})
+
+		require.EqualError(t, err, "Message must have either content or embeds")
+	})
+
+	t.Run("Closed", func(t *testing.T) {
+		o, _ := OpenOutbox(t.TempDir(), unreachableClient(), WithRetryInterval(time.Hour))
+		o.Add(Message{Content: "1"})
+
+		require.NoError(t, o.Close(context.Background()), "Closed failed")
+		require.ErrorIs(t, o.Add(Message{Content: "2"}), ErrOutboxClosed, "Closed failed")
+		require.ErrorIs(t, o.Flush(context.Background()), ErrOutboxClosed, "Closed failed")
+		require.NoError(t, o.Close(context.Background()), "Closed failed")
+	})
+
+	t.Run("Close cancels send", func(t *testing.T) {
+		release := make(chan struct{})
+		received := make(chan struct{}, 1)
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			received <- struct{}{}
+			<-release
+		}))
+		defer server.Close()
+		defer close(release)
+		dir := t.TempDir()
+		o, _ := OpenOutbox(dir, &Client{url: server.URL, client: http.DefaultClient})
+		o.Add(Message{Content: "1"})
+		<-received
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+
+		err := o.Close(ctx)
+
+		require.ErrorIs(t, err, context.DeadlineExceeded, "Close cancels send failed")
+		o, _ = OpenOutbox(dir, unreachableClient(), WithRetryInterval(time.Hour))
+		defer o.Close(context.Background())
+		require.Equal(t, 1, o.Stats().Pending, "Close cancels send failed")
+	})
+}
+
+func TestOutboxCorruption(t *testing.T) {
+	// addMessages stores two messages in a new Outbox of dir and returns its
+	// only segment.
+	addMessages := func(t *testing.T, dir string) string {
+		o, err := OpenOutbox(dir, unreachableClient(), WithRetryInterval(time.Hour))
+		require.NoError(t, err, "Open failed")
+		o.Add(Message{Content: "1"})
+		o.Add(Message{Content: "2"})
+		o.Close(context.Background())
+		files := segmentFiles(t, dir)
+		require.Len(t, files, 1, "Open failed")
+		return files[0]
+	}
+
+	t.Run("Truncated record", func(t *testing.T) {
+		dir := t.TempDir()
+		path := addMessages(t, dir)
+		// A crash in the middle of writing a record.
+		f, _ := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0)
+		f.Write([]byte{0, 0, 1, 0, 1, 2, 3, 4, '{'})
+		f.Close()
+		server := newTestServer(nil)
+		defer server.Close()
+
+		o, err := OpenOutbox(dir, server.client())
+		require.NoError(t, err, "Truncated record failed")
+		defer o.Close(context.Background())
+		require.NoError(t, o.Add(Message{Content: "3"}), "Truncated record failed")
+		o.Flush(context.Background())
+
+		require.Equal(t, []string{`{"content":"1"}`, `{"content":"2"}`, `{"content":"3"}`}, server.Bodies(), "Truncated record failed")
+		require.Equal(t, 1, o.Stats().Corrupted, "Truncated record failed")
+	})
+
+	t.Run("Checksum mismatch", func(t *testing.T) {
+		dir := t.TempDir()
+		path := addMessages(t, dir)
+		data, _ := os.ReadFile(path)
+		// Flip a byte in the payload of the second record.
+		second := 8 + int(binary.BigEndian.Uint32(data[:4]))
+		data[second+10] ^= 0xff
+		os.WriteFile(path, data, 0o600)
+
+		o, err := OpenOutbox(dir, unreachableClient(), WithRetryInterval(time.Hour))
+		require.NoError(t, err, "Checksum mismatch failed")
+		defer o.Close(context.Background())
+
+		require.Equal(t, OutboxStats{Pending: 1, Corrupted: 1}, o.Stats(), "Checksum mismatch failed")
+	})
+
+	// failWrite makes the next write of o stop after n bytes, Truncate fails
+	// too when truncate is set.
+	failWrite := func(o *Outbox, n int, truncate bool) {
+		o.mu.Lock()
+		defer o.mu.Unlock()
+		o.file = &failingFile{File: o.file.(*os.File), n: n, truncate: truncate}
+	}
+
+	t.Run("Partly written record", func(t *testing.T) {
+		dir := t.TempDir()
+		o, _ := OpenOutbox(dir, unreachableClient(), WithRetryInterval(time.Hour))
+		o.Add(Message{Content: "1"})
+		failWrite(o, 12, false)
+
+		require.Error(t, o.Add(Message{Content: "2"}), "Partly written record failed")
+		require.NoError(t, o.Add(Message{Content: "3"}), "Partly written record failed")
+		o.Close(context.Background())
+		server := newTestServer(nil)
+		defer server.Close()
+
+		o, err := OpenOutbox(dir, server.client())
+		require.NoError(t, err, "Partly written record failed")
+		defer o.Close(context.Background())
+		require.Equal(t, 0, o.Stats().Corrupted, "Partly written record failed")
+		o.Flush(context.Background())
+		require.Equal(t, []string{"1", "3"}, server.Contents(), "Partly written record failed")
+	})
+
+	t.Run("Truncate error", func(t *testing.T) {
+		dir := t.TempDir()
+		o, _ := OpenOutbox(dir, unreachableClient(), WithRetryInterval(time.Hour))
+		o.Add(Message{Content: "1"})
+		failWrite(o, 12, true)
+
+		require.Error(t, o.Add(Message{Content: "2"}), "Truncate error failed")
+		require.NoError(t, o.Add(Message{Content: "3"}), "Truncate error failed")
+		o.Close(context.Background())
+		server := newTestServer(nil)
+		defer server.Close()
+
+		// The broken record is left at the end of the first segment.
+		o, err := OpenOutbox(dir, server.client())
+		require.NoError(t, err, "Truncate error failed")
+		defer o.Close(context.Background())
+		require.Equal(t, 1, o.Stats().Corrupted, "Truncate error failed")
+		o.Flush(context.Background())
+		require.Equal(t, []string{"1", "3"}, server.Contents(), "Truncate error failed")
+	})
+
+	t.Run("Invalid record", func(t *testing.T) {
+		_, err := readFrame(strings.NewReader("\xff\xff\xff\xff\x00\x00\x00\x00"))
+
+		require.EqualError(t, err, "invalid record size")
+	})
+
+	t.Run("Other files", func(t *testing.T) {
+		dir := t.TempDir()
+		os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("notes"), 0o600)
+		os.WriteFile(filepath.Join(dir, "x"+segmentExt), []byte("x"), 0o600)
+
+		o, err := OpenOutbox(dir, unreachableClient())
+		require.NoError(t, err, "Other files failed")
+		defer o.Close(context.Background())
+
+		require.Equal(t, OutboxStats{}, o.Stats(), "Other files failed")
+	})
+}
+
+// failingFile writes the first n bytes of its first write and fails it.
+type failingFile struct {
+	*os.File
+	n        int
+	truncate bool // Whether Truncate fails.
+	failed   bool
+}
+
+func (f *failingFile) Write(b []byte) (int, error) {
+	if f.failed {
+		return f.File.Write(b)
+	}
+	f.failed = true
+	n, _ := f.File.Write(b[:f.n])
+	return n, errors.New("no space left on device")
+}
+
+func (f *failingFile) Truncate(size int64) error {
+	if f.truncate {
+		return errors.New("truncate failed")
+	}
+	return f.File.Truncate(size)
+}
+
+func TestOutboxCompaction(t *testing.T) {
+	t.Run("Sent segments deleted", func(t *testing.T) {
+		dir := t.TempDir()
+		release := make(chan struct{})
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			<-release
+			w.WriteHeader(http.StatusNoContent)
+		}))
+		defer server.Close()
+		// Every message starts a new segment.
+		o, _ := OpenOutbox(dir, &Client{url: server.URL, client: http.DefaultClient}, WithSegmentSize(1))
+		defer o.Close(context.Background())
+		for _, content := range []string{"1", "2", "3"} {
+			require.NoError(t, o.Add(Message{Content: content}), "Sent segments deleted failed")
+		}
+		require.Len(t, segmentFiles(t, dir), 3, "Sent segments deleted failed")
+
+		close(release)
+		require.NoError(t, o.Flush(context.Background()), "Sent segments deleted failed")
+
+		require.Len(t, segmentFiles(t, dir), 1, "Sent segments deleted failed")
+	})
+
+	t.Run("Pending segments kept", func(t *testing.T) {
+		dir := t.TempDir()
+		o, _ := OpenOutbox(dir, unreachableClient(), WithSegmentSize(1), WithRetryInterval(time.Hour))
+		o.Add(Message{Content: "1"})
+		o.Add(Message{Content: "2"})
+		o.Close(context.Background())
+
+		o, _ = OpenOutbox(dir, unreachableClient(), WithRetryInterval(time.Hour))
+		defer o.Close(context.Background())
+
+		require.Len(t, segmentFiles(t, dir), 3, "Pending segments kept failed")
+		require.Equal(t, 2, o.Stats().Pending, "Pending segments kept failed")
+	})
+
+	t.Run("Reopen", func(t *testing.T) {
+		dir := t.TempDir()
+		server := newTestServer(nil)
+		defer server.Close()
+		for i := 0; i < 3; i++ {
+			o, err := OpenOutbox(dir, server.client())
+			require.NoError(t, err, "Reopen failed")
+			o.Add(Message{Content: "1"})
+			o.Flush(context.Background())
+			o.Close(context.Background())
+		}
+
+		require.Len(t, segmentFiles(t, dir), 1, "Reopen failed")
+		require.Len(t, server.Bodies(), 3, "Reopen failed")
+	})
+}
+
+func TestOutboxMessage(t *testing.T) {
+	buffered, _ := bufferFiles([]Message{{
+		Content:  "1",
+		ThreadID: "300",
+		DedupKey: "job-1",
+		Files:    []*File{{Name: "a.txt", ContentType: "text/plain", Reader: strings.NewReader("file")}, {Name: "empty.txt", Reader: strings.NewReader("")}},
+	}})
+
+	msg := encodeOutboxMessage(buffered[0]).decode()
+
+	require.Equal(t, "1", msg.Content, "Outbox message failed")
+	require.Equal(t, "300", msg.ThreadID, "Outbox message failed")
+	require.Equal(t, "job-1", msg.DedupKey, "Outbox message failed")
+	contentType, body, err := writeBody(msg)
+	require.NoError(t, err, "Outbox message failed")
+	_, params, _ := mime.ParseMediaType(contentType)
+	reader := multipart.NewReader(body, params["boundary"])
+	reader.NextPart()
+	part, _ := reader.NextPart()
+	content, _ := io.ReadAll(part)
+	require.Equal(t, "a.txt", part.FileName(), "Outbox message failed")
+	require.Equal(t, "file", string(content), "Outbox message failed")
+}
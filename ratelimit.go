@@ -1,23 +1,333 @@
 package messenger
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
 	"net/http"
 	"strconv"
+	"strings"
+	"sync"
 	"time"
 )
 
-// HandleRateLimit analysis the response header from Discord to comply with their dynamic
-// rate limit.
-// IMPORTANT: the function cannot prevent "webhook message/channel/min" limit.
-func handleRateLimit(header http.Header) error {
+// RateLimitError is returned when Discord still responds 429 Too Many Requests
+// after all attempts of a message are used.
+type RateLimitError struct {
+	// RetryAfter is the wait Discord asked for in the last response.
+	RetryAfter time.Duration
+	// Global reports whether the global rate limit was hit rather than the
+	// limit of the webhook.
+	Global   bool
+	Attempts int
+}
+
+func (e *RateLimitError) Error() string {
+	scope := "webhook"
+	if e.Global {
+		scope = "global"
+	}
+	return fmt.Sprintf("Discord API error: %s rate limit hit after %d attempts, retry after %s", scope, e.Attempts, e.RetryAfter)
+}
+
+// parseTooManyRequests reads the wait requested by a 429 response. The
+// "retry_after" body field is preferred since the Retry-After header is
+// rounded up to whole seconds.
+// https://discord.com/developers/docs/topics/rate-limits#exceeding-a-rate-limit
+func parseTooManyRequests(resp *http.Response) (*RateLimitError, error) {
+	var body struct {
+		RetryAfter *float64 `json:"retry_after"`
+		Global     bool     `json:"global"`
+	}
+	// Proxies in front of Discord may answer 429 without a JSON body, the
+	// headers are used then.
+	_ = json.NewDecoder(resp.Body).Decode(&body)
+
+	limitErr := &RateLimitError{
+		Global: body.Global || resp.Header.Get("x-ratelimit-global") == "true",
+	}
+	if body.RetryAfter != nil {
+		limitErr.RetryAfter = seconds(*body.RetryAfter)
+		return limitErr, nil
+	}
+
+	retryAfter := resp.Header.Get("retry-after")
+	if retryAfter == "" {
+		return limitErr, nil
+	}
+	wait, err := parseSeconds(retryAfter)
+	if err != nil {
+		return nil, err
+	}
+	limitErr.RetryAfter = wait
+	return limitErr, nil
+}
+
+// bodyRetryAfter reads the "retry_after" field of a 429 body. The body is
+// left to be read again by the client.
+func bodyRetryAfter(resp *http.Response) (time.Duration, bool) {
+	if resp.Body == nil {
+		return 0, false
+	}
+	b, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	resp.Body = io.NopCloser(bytes.NewReader(b))
+	if err != nil {
+		return 0, false
+	}
+	var body struct {
+		RetryAfter *float64 `json:"retry_after"`
+	}
+	if json.Unmarshal(b, &body) != nil || body.RetryAfter == nil {
+		return 0, false
+	}
+	return seconds(*body.RetryAfter), true
+}
+
+// seconds converts a wait in fractional seconds reported by Discord, rounded up
+// to the millisecond so that it never ends early.
+func seconds(s float64) time.Duration {
+	return time.Duration(math.Ceil(s*1000)) * time.Millisecond
+}
+
+// parseSeconds parses a header holding a wait in fractional seconds.
+func parseSeconds(h string) (time.Duration, error) {
+	s, err := strconv.ParseFloat(h, 64)
+	if err != nil {
+		return 0, err
+	}
+	return seconds(s), nil
+}
+
+// RateLimit is the rate limit state Discord reports in response headers.
+// https://discord.com/developers/docs/topics/rate-limits#header-format
+type RateLimit struct {
+	// Bucket identifies the quota shared by the routes reporting the same one.
+	Bucket    string
+	Limit     int
+	Remaining int
+	// Reset is when the quota resets, by Discord clock.
+	Reset      time.Time
+	ResetAfter time.Duration
+	// Global reports whether a 429 response was caused by the global limit.
+	Global bool
+	// Scope of a 429 response, one of "user", "global" or "shared".
+	Scope string
+}
+
+// parseRateLimit reads the rate limit headers. Headers that are missing or
+// malformed are left as zero values.
+func parseRateLimit(header http.Header) RateLimit {
+	rl := RateLimit{
+		Bucket: header.Get("x-ratelimit-bucket"),
+		Global: header.Get("x-ratelimit-global") == "true",
+		Scope:  header.Get("x-ratelimit-scope"),
+	}
+	rl.Limit, _ = strconv.Atoi(header.Get("x-ratelimit-limit"))
+	rl.Remaining, _ = strconv.Atoi(header.Get("x-ratelimit-remaining"))
+	rl.ResetAfter, _ = parseSeconds(header.Get("x-ratelimit-reset-after"))
+	rl.Reset, _ = parseEpoch(header.Get("x-ratelimit-reset"))
+	return rl
+}
+
+// parseEpoch parses a header holding epoch time in fractional seconds.
+func parseEpoch(h string) (time.Time, error) {
+	epoch, err := strconv.ParseFloat(h, 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+	sec, frac := math.Modf(epoch)
+	return time.Unix(int64(sec), int64(frac*float64(time.Second))), nil
+}
+
+// RateLimiter paces the requests a Client makes to Discord. A RateLimiter
+// shared between clients must be safe for concurrent use. A RateLimiter
+// reserving quota in Wait may also implement Cancel(req *http.Request), called
+// when req gets no response, e.g. on a network error.
+type RateLimiter interface {
+	// Wait blocks until req may be sent. It returns the ctx error if ctx is
+	// done first.
+	Wait(ctx context.Context, req *http.Request) error
+	// Update records the rate limit state reported by resp.
+	Update(resp *http.Response) error
+}
+
+// canceler is a RateLimiter giving back the quota Wait reserved for requests
+// without a response.
+type canceler interface {
+	Cancel(req *http.Request)
+}
+
+// cancelWait calls the Cancel method of l, if any.
+func cancelWait(l RateLimiter, req *http.Request) {
+	if c, ok := l.(canceler); ok {
+		c.Cancel(req)
+	}
+}
+
+// WithRateLimiter replaces the default HeaderRateLimiter of a Client.
+func WithRateLimiter(l RateLimiter) Option {
+	return func(c *Client) {
+		c.limiter = l
+	}
+}
+
+// HeaderRateLimiter complies with the dynamic rate limit Discord reports in
+// response headers. Quota is tracked per X-RateLimit-Bucket so that concurrent
+// callers sharing it are held back before the quota runs out. It is the default
+// RateLimiter of a Client and the zero value is ready to use.
+// IMPORTANT: it cannot prevent "webhook message/channel/min" limit, use a
+// TokenBucket for that.
+type HeaderRateLimiter struct {
+	// Margin is added to every reset to absorb network latency, so that
+	// requests held until the reset do not arrive before it.
+	Margin time.Duration
+	// Jitter is the upper bound of a random delay added to every wait, so that
+	// callers held until the same reset do not all fire at once.
+	Jitter time.Duration
+
+	mu      sync.Mutex
+	routes  map[string]string // Route of a request to the bucket it belongs to, see route.
+	buckets map[string]*bucket
+	global  time.Time     // Every request is held until the global limit resets.
+	skew    time.Duration // Offset of Discord clock from the local one.
+	skewSet bool          // Whether skew was measured from reset headers.
+}
+
+// bucket is the quota Discord shares between the routes reporting the same
+// X-RateLimit-Bucket.
+type bucket struct {
+	limit      int
+	remaining  int
+	reset      time.Time
+	resetAfter time.Duration // Length of the last reported window.
+	inflight   int           // Requests reserved but not responded yet.
+}
+
+// respond ends a request of the bucket whose response reported remaining.
+func (b *bucket) respond(remaining int) {
+	if b.inflight > 0 {
+		b.inflight--
+	}
+	// Discord has not counted the requests still in flight yet.
+	b.remaining = remaining - b.inflight
+	if b.remaining < 0 {
+		b.remaining = 0
+	}
+}
+
+// route identifies the rate limited resource of req: the method and the path
+// of the webhook, holding its id and token. The id of an edited or deleted
+// message is left out so that routes do not grow with every message.
+func route(req *http.Request) string {
+	path := req.URL.Path
+	if i := strings.Index(path, "/messages/"); i >= 0 {
+		path = path[:i+len("/messages")]
+	}
+	return req.Method + " " + path
+}
+
+// Wait blocks until the bucket of req has quota left and reserves one request
+// from it. Requests to routes not seen yet are not held.
+func (l *HeaderRateLimiter) Wait(ctx context.Context, req *http.Request) error {
+	key := route(req)
+	for {
+		wait := l.reserve(key, time.Now())
+		if wait <= 0 {
+			return nil
+		}
+		if err := sleep(ctx, wait+l.jitter()); err != nil {
+			return err
+		}
+	}
+}
+
+func (l *HeaderRateLimiter) jitter() time.Duration {
+	if l.Jitter <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(l.Jitter) + 1))
+}
+
+// reserve takes one request from the bucket of route, or returns how long to
+// wait before trying again.
+func (l *HeaderRateLimiter) reserve(route string, now time.Time) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if now.Before(l.global) {
+		return l.global.Sub(now)
+	}
+	b, ok := l.buckets[l.routes[route]]
+	if !ok {
+		return 0
+	}
+	if !now.Before(b.reset) {
+		// The window passed without a response reporting the new one, assume
+		// it has the same length as the last one.
+		b.remaining = b.limit
+		b.reset = now.Add(b.resetAfter + l.Margin)
+		b.inflight = 0
+	}
+	if b.remaining > 0 {
+		b.remaining--
+		b.inflight++
+		return 0
+	}
+	return b.reset.Sub(now)
+}
+
+// Cancel gives back the request Wait reserved for req, which got no response.
+// Its quota is not given back since Discord may have counted it.
+func (l *HeaderRateLimiter) Cancel(req *http.Request) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if b, ok := l.buckets[l.routes[route(req)]]; ok && b.inflight > 0 {
+		b.inflight--
+	}
+}
+
+// Update analysis the response header from Discord to comply with their
+// dynamic rate limit.
+func (l *HeaderRateLimiter) Update(resp *http.Response) error {
+	now := time.Now()
+	// Responses not updating a bucket end the request reserved anyway.
+	updated := false
+	defer func() {
+		if !updated && resp.Request != nil {
+			l.Cancel(resp.Request)
+		}
+	}()
+	if resp.StatusCode == http.StatusTooManyRequests && resp.Header.Get("x-ratelimit-global") == "true" {
+		// The wait of a global limit is reported in Retry-After, and in the
+		// body by Discord.
+		retryAfter, err := parseSeconds(resp.Header.Get("retry-after"))
+		if err != nil {
+			var ok bool
+			if retryAfter, ok = bodyRetryAfter(resp); !ok {
+				// The client waits what the 429 asks for, if anything.
+				return nil
+			}
+		}
+		l.mu.Lock()
+		l.global = now.Add(retryAfter + l.Margin)
+		l.mu.Unlock()
+		return nil
+	}
+
 	// x-ratelimit-remaining contains the number of remaining quota.
-	remaining := header.Get("x-ratelimit-remaining")
+	remaining := resp.Header.Get("x-ratelimit-remaining")
 	// x-ratelimit-reset-after indicate the time (in sec) after which the limit
-	// will be reset.
-	resetAfter := header.Get("x-ratelimit-reset-after")
+	// will be reset. x-ratelimit-reset is the same instant as epoch time.
+	resetAfter := resp.Header.Get("x-ratelimit-reset-after")
+	reset := resp.Header.Get("x-ratelimit-reset")
 	// Discord sometimes respond w/o those headers.
 	// No headers, no limit.
-	if remaining == "" && resetAfter == "" {
+	if remaining == "" && resetAfter == "" && reset == "" {
 		return nil
 	}
 
@@ -25,14 +335,213 @@ func handleRateLimit(header http.Header) error {
 	if err != nil {
 		return err
 	}
-	if r > 0 {
-		return nil
+	// Without x-ratelimit-limit only one request is let through once the
+	// window passes, its response reports the quota again.
+	limit := 1
+	if h := resp.Header.Get("x-ratelimit-limit"); h != "" {
+		if limit, err = strconv.Atoi(h); err != nil {
+			return err
+		}
+	}
+
+	var key string
+	if resp.Request != nil {
+		key = route(resp.Request)
+	}
+	// Responses w/o bucket header are tracked per route.
+	id := resp.Header.Get("x-ratelimit-bucket")
+	if id == "" {
+		id = key
 	}
 
-	wait, err := strconv.ParseFloat(resetAfter, 64)
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if resetAfter == "" && reset == "" {
+		// Without reset only the quota left is known, it is recorded in the
+		// bucket of a route tracked already.
+		if b, ok := l.buckets[l.routes[key]]; ok {
+			b.respond(r)
+			updated = true
+		}
+		return nil
+	}
+	resetAt, err := l.resetTime(resetAfter, reset, resp.Header.Get("date"), now)
 	if err != nil {
 		return err
 	}
-	time.Sleep(time.Duration(wait) * time.Second)
+	if l.routes == nil {
+		l.routes = make(map[string]string)
+		l.buckets = make(map[string]*bucket)
+	}
+	l.routes[key] = id
+
+	b, ok := l.buckets[id]
+	if !ok {
+		b = &bucket{}
+		l.buckets[id] = b
+	}
+	b.respond(r)
+	updated = true
+	b.limit = limit
+	b.resetAfter = resetAt.Sub(now)
+	b.reset = resetAt.Add(l.Margin)
 	return nil
 }
+
+// resetTime works out when a quota resets in local time. The epoch reset is
+// used when present, corrected by the offset between Discord clock and the
+// local one. The offset is measured whenever both reset headers are present,
+// the Date header gives a rough one until then.
+func (l *HeaderRateLimiter) resetTime(resetAfter, reset, date string, now time.Time) (time.Time, error) {
+	var after time.Duration
+	if resetAfter != "" || reset == "" {
+		var err error
+		if after, err = parseSeconds(resetAfter); err != nil {
+			return time.Time{}, err
+		}
+		if reset == "" {
+			return now.Add(after), nil
+		}
+	}
+
+	resetAt, err := parseEpoch(reset)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	switch {
+	case resetAfter != "":
+		// Both headers describe the same instant.
+		l.skew = resetAt.Sub(now.Add(after))
+		l.skewSet = true
+	case !l.skewSet:
+		// Date only has second precision, smaller offsets are noise.
+		if d, err := http.ParseTime(date); err == nil {
+			if skew := d.Sub(now); skew > time.Second || skew < -time.Second {
+				l.skew = skew
+			}
+		}
+	}
+	return resetAt.Add(-l.skew), nil
+}
+
+// Undocumented limit on messages posted to one channel by webhooks.
+const (
+	ChannelMessageLimit  = 30
+	ChannelMessageWindow = time.Minute
+)
+
+// TokenBucket allows a burst of up to n messages and refills at n messages per
+// interval. Only message creation (POST) requests take a token. Share one
+// TokenBucket between the clients of all webhooks posting to the same channel.
+// Unlike HeaderRateLimiter, the zero value cannot be used, create it with
+// NewTokenBucket or NewChannelRateLimiter.
+type TokenBucket struct {
+	mu       sync.Mutex
+	capacity float64
+	rate     float64 // Tokens per second.
+	tokens   float64
+	last     time.Time
+}
+
+// NewTokenBucket creates a full TokenBucket allowing n messages per interval.
+// n below 1 counts as 1 and a non-positive interval as ChannelMessageWindow.
+func NewTokenBucket(n int, interval time.Duration) *TokenBucket {
+	if n < 1 {
+		n = 1
+	}
+	if interval <= 0 {
+		interval = ChannelMessageWindow
+	}
+	return &TokenBucket{
+		capacity: float64(n),
+		rate:     float64(n) / interval.Seconds(),
+		tokens:   float64(n),
+		last:     time.Now(),
+	}
+}
+
+// NewChannelRateLimiter creates a TokenBucket enforcing the 30 messages per
+// minute limit Discord applies to webhooks posting to the same channel.
+func NewChannelRateLimiter() *TokenBucket {
+	return NewTokenBucket(ChannelMessageLimit, ChannelMessageWindow)
+}
+
+// Wait blocks until a token is available and takes it.
+func (b *TokenBucket) Wait(ctx context.Context, req *http.Request) error {
+	if req.Method != http.MethodPost {
+		return nil
+	}
+	for {
+		b.mu.Lock()
+		now := time.Now()
+		b.tokens += now.Sub(b.last).Seconds() * b.rate
+		if b.tokens > b.capacity {
+			b.tokens = b.capacity
+		}
+		b.last = now
+		if b.tokens >= 1 {
+			b.tokens--
+			b.mu.Unlock()
+			return nil
+		}
+		wait := time.Duration((1 - b.tokens) / b.rate * float64(time.Second))
+		b.mu.Unlock()
+
+		if err := sleep(ctx, wait); err != nil {
+			return err
+		}
+	}
+}
+
+// Update does nothing, the bucket does not depend on responses.
+func (b *TokenBucket) Update(resp *http.Response) error {
+	return nil
+}
+
+type multiRateLimiter []RateLimiter
+
+// MultiRateLimiter combines limiters so that a request waits for each of them
+// in order and every response updates all of them.
+func MultiRateLimiter(limiters ...RateLimiter) RateLimiter {
+	return multiRateLimiter(limiters)
+}
+
+func (m multiRateLimiter) Wait(ctx context.Context, req *http.Request) error {
+	for _, l := range m {
+		if err := l.Wait(ctx, req); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m multiRateLimiter) Cancel(req *http.Request) {
+	for _, l := range m {
+		cancelWait(l, req)
+	}
+}
+
+func (m multiRateLimiter) Update(resp *http.Response) error {
+	for _, l := range m {
+		if err := l.Update(resp); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sleep pauses for duration d, returning ctx error if ctx is done before that.
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -1,30 +1,54 @@
 package messenger
 
 import (
+	"context"
+	"errors"
+	"io"
 	"net/http"
+	"net/http/httptest"
 	"strconv"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 )
 
-func TestWait(t *testing.T) {
+// rateLimitResponse creates a response to a webhook execution carrying rate
+// limit headers.
+func rateLimitResponse(bucket, limit, remaining, resetAfter string) *http.Response {
+	header := http.Header{}
+	header.Set("x-ratelimit-bucket", bucket)
+	header.Set("x-ratelimit-limit", limit)
+	header.Set("x-ratelimit-remaining", remaining)
+	header.Set("x-ratelimit-reset-after", resetAfter)
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     header,
+		Request:    httptest.NewRequest(http.MethodPost, "/api/webhooks/1/token", nil),
+	}
+}
+
+func TestHeaderRateLimiterUpdate(t *testing.T) {
 	t.Run("No limit", func(t *testing.T) {
 		header := http.Header{}
 		header.Set("x-ratelimit-remaining", "")
 		header.Set("x-ratelimit-reset-after", "")
+		l := &HeaderRateLimiter{}
 
-		err := handleRateLimit(header)
+		err := l.Update(&http.Response{Header: header})
 
 		require.Equal(t, nil, err, "No limit failed")
+		require.Empty(t, l.buckets, "No limit failed")
 	})
 
 	t.Run("Atoi error", func(t *testing.T) {
 		header := http.Header{}
 		header.Set("x-ratelimit-remaining", "")
 		header.Set("x-ratelimit-reset-after", "something") // Avoid return by empty check
+		l := &HeaderRateLimiter{}
 
-		err := handleRateLimit(header)
+		err := l.Update(&http.Response{Header: header})
 
 		_, ok := err.(*strconv.NumError)
 		if !ok {
@@ -32,22 +56,13 @@ func TestWait(t *testing.T) {
 		}
 	})
 
-	t.Run("Quota not exhausted", func(t *testing.T) {
-		header := http.Header{}
-		header.Set("x-ratelimit-remaining", "1")
-		header.Set("x-ratelimit-reset-after", "0")
-
-		err := handleRateLimit(header)
-
-		require.Equal(t, nil, err, "Quota not exhausted failed")
-	})
-
 	t.Run("ParseFloat error", func(t *testing.T) {
 		header := http.Header{}
 		header.Set("x-ratelimit-remaining", "0")
-		header.Set("x-ratelimit-reset-after", "")
+		header.Set("x-ratelimit-reset-after", "a")
+		l := &HeaderRateLimiter{}
 
-		err := handleRateLimit(header)
+		err := l.Update(&http.Response{Header: header})
 
 		_, ok := err.(*strconv.NumError)
 		if !ok {
@@ -55,13 +70,582 @@ func TestWait(t *testing.T) {
 		}
 	})
 
-	t.Run("Return nil after sleep", func(t *testing.T) {
+	t.Run("Remaining without reset", func(t *testing.T) {
+		l := &HeaderRateLimiter{}
+		l.Update(rateLimitResponse("abc", "5", "4", "2"))
+		reset := l.buckets["abc"].reset
+		resp := rateLimitResponse("abc", "5", "0", "")
+
+		err := l.Update(resp)
+
+		require.NoError(t, err, "Remaining without reset failed")
+		require.Equal(t, 0, l.buckets["abc"].remaining, "Remaining without reset failed")
+		require.Equal(t, reset, l.buckets["abc"].reset, "Remaining without reset failed")
+		resp.Request = httptest.NewRequest(http.MethodPost, "/api/webhooks/2/token", nil)
+		require.NoError(t, l.Update(resp), "Remaining without reset failed")
+		require.Len(t, l.buckets, 1, "Remaining without reset failed")
+	})
+
+	t.Run("Limit Atoi error", func(t *testing.T) {
+		l := &HeaderRateLimiter{}
+
+		err := l.Update(rateLimitResponse("abc", "many", "1", "1"))
+
+		require.IsType(t, &strconv.NumError{}, err, "Limit Atoi error failed")
+	})
+
+	t.Run("Quota tracked per bucket", func(t *testing.T) {
+		l := &HeaderRateLimiter{}
+
+		err := l.Update(rateLimitResponse("abc", "5", "4", "2"))
+
+		require.NoError(t, err, "Quota tracked per bucket failed")
+		require.Equal(t, "abc", l.routes["POST /api/webhooks/1/token"], "Quota tracked per bucket failed")
+		b := l.buckets["abc"]
+		require.Equal(t, 5, b.limit, "Quota tracked per bucket failed")
+		require.Equal(t, 4, b.remaining, "Quota tracked per bucket failed")
+		require.WithinDuration(t, time.Now().Add(2*time.Second), b.reset, 100*time.Millisecond, "Quota tracked per bucket failed")
+	})
+
+	t.Run("No bucket header", func(t *testing.T) {
+		l := &HeaderRateLimiter{}
+
+		err := l.Update(rateLimitResponse("", "", "0", "1"))
+
+		require.NoError(t, err, "No bucket header failed")
+		b := l.buckets["POST /api/webhooks/1/token"]
+		require.Equal(t, 1, b.limit, "No bucket header failed")
+		require.Equal(t, 0, b.remaining, "No bucket header failed")
+	})
+
+	t.Run("Requests in flight", func(t *testing.T) {
+		l := &HeaderRateLimiter{}
+		l.Update(rateLimitResponse("abc", "5", "4", "2"))
+		req := httptest.NewRequest(http.MethodPost, "/api/webhooks/1/token", nil)
+		l.Wait(context.Background(), req)
+		l.Wait(context.Background(), req)
+
+		// Response of the first reserved request, the second one is still in flight.
+		err := l.Update(rateLimitResponse("abc", "5", "3", "2"))
+
+		require.NoError(t, err, "Requests in flight failed")
+		require.Equal(t, 2, l.buckets["abc"].remaining, "Requests in flight failed")
+		require.Equal(t, 1, l.buckets["abc"].inflight, "Requests in flight failed")
+	})
+
+	t.Run("Message routes", func(t *testing.T) {
+		l := &HeaderRateLimiter{}
+		for _, id := range []string{"10", "11"} {
+			resp := rateLimitResponse("abc", "5", "4", "2")
+			resp.Request = httptest.NewRequest(http.MethodPatch, "/api/webhooks/1/token/messages/"+id, nil)
+
+			require.NoError(t, l.Update(resp), "Message routes failed")
+		}
+
+		require.Equal(t, map[string]string{"PATCH /api/webhooks/1/token/messages": "abc"}, l.routes, "Message routes failed")
+	})
+
+	t.Run("Response without headers", func(t *testing.T) {
+		l := &HeaderRateLimiter{}
+		l.Update(rateLimitResponse("abc", "5", "4", "2"))
+		req := httptest.NewRequest(http.MethodPost, "/api/webhooks/1/token", nil)
+		l.Wait(context.Background(), req)
+
+		err := l.Update(&http.Response{StatusCode: http.StatusNoContent, Header: http.Header{}, Request: req})
+
+		require.NoError(t, err, "Response without headers failed")
+		require.Zero(t, l.buckets["abc"].inflight, "Response without headers failed")
+	})
+
+	t.Run("Global limit", func(t *testing.T) {
 		header := http.Header{}
-		header.Set("x-ratelimit-remaining", "0")
-		header.Set("x-ratelimit-reset-after", "0")
+		header.Set("x-ratelimit-global", "true")
+		header.Set("retry-after", "3")
+		l := &HeaderRateLimiter{}
+
+		err := l.Update(&http.Response{StatusCode: http.StatusTooManyRequests, Header: header})
+
+		require.NoError(t, err, "Global limit failed")
+		require.WithinDuration(t, time.Now().Add(3*time.Second), l.global, 100*time.Millisecond, "Global limit failed")
+	})
+
+	t.Run("Global body retry_after", func(t *testing.T) {
+		header := http.Header{}
+		header.Set("x-ratelimit-global", "true")
+		l := &HeaderRateLimiter{}
+		body := `{"message": "You are being rate limited.", "retry_after": 2, "global": true}`
+		resp := &http.Response{StatusCode: http.StatusTooManyRequests, Header: header, Body: io.NopCloser(strings.NewReader(body))}
+
+		err := l.Update(resp)
+
+		require.NoError(t, err, "Global body retry_after failed")
+		require.WithinDuration(t, time.Now().Add(2*time.Second), l.global, 100*time.Millisecond, "Global body retry_after failed")
+		b, _ := io.ReadAll(resp.Body)
+		require.Equal(t, body, string(b), "Global body retry_after failed")
+	})
+
+	t.Run("Global without wait", func(t *testing.T) {
+		header := http.Header{}
+		header.Set("x-ratelimit-global", "true")
+		header.Set("retry-after", "a")
+		l := &HeaderRateLimiter{}
+
+		err := l.Update(&http.Response{StatusCode: http.StatusTooManyRequests, Header: header})
+
+		require.NoError(t, err, "Global without wait failed")
+		require.True(t, l.global.IsZero(), "Global without wait failed")
+	})
+}
+
+func TestHeaderRateLimiterWait(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPost, "/api/webhooks/1/token", nil)
+
+	t.Run("Unknown route", func(t *testing.T) {
+		l := &HeaderRateLimiter{}
+
+		err := l.Wait(context.Background(), req)
+
+		require.NoError(t, err, "Unknown route failed")
+	})
+
+	t.Run("Reserve quota", func(t *testing.T) {
+		l := &HeaderRateLimiter{}
+		l.Update(rateLimitResponse("abc", "5", "2", "60"))
+
+		require.NoError(t, l.Wait(context.Background(), req))
+		require.NoError(t, l.Wait(context.Background(), req))
+		require.Equal(t, 0, l.buckets["abc"].remaining, "Reserve quota failed")
+		require.Equal(t, time.Minute, l.reserve(route(req), time.Now()).Round(time.Second), "Reserve quota failed")
+	})
+
+	t.Run("Wait until reset", func(t *testing.T) {
+		l := &HeaderRateLimiter{}
+		l.Update(rateLimitResponse("abc", "5", "0", "0"))
+		l.buckets["abc"].reset = time.Now().Add(20 * time.Millisecond)
+		start := time.Now()
+
+		err := l.Wait(context.Background(), req)
+
+		require.NoError(t, err, "Wait until reset failed")
+		require.GreaterOrEqual(t, time.Since(start), 15*time.Millisecond, "Wait until reset failed")
+		require.Equal(t, 4, l.buckets["abc"].remaining, "Wait until reset failed")
+	})
+
+	t.Run("Shared between goroutines", func(t *testing.T) {
+		l := &HeaderRateLimiter{}
+		l.Update(rateLimitResponse("abc", "2", "2", "60"))
+		errs := make(chan error, 3)
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+
+		for i := 0; i < 3; i++ {
+			go func() { errs <- l.Wait(ctx, req) }()
+		}
+
+		var held int
+		for i := 0; i < 3; i++ {
+			if err := <-errs; err != nil {
+				held++
+			}
+		}
+		require.Equal(t, 1, held, "Shared between goroutines failed")
+	})
+
+	t.Run("Global limit", func(t *testing.T) {
+		l := &HeaderRateLimiter{global: time.Now().Add(time.Minute)}
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+
+		err := l.Wait(ctx, req)
+
+		require.ErrorIs(t, err, context.DeadlineExceeded, "Global limit failed")
+	})
+}
+
+func TestHeaderRateLimiterCancel(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPost, "/api/webhooks/1/token", nil)
+
+	t.Run("Reserved request", func(t *testing.T) {
+		l := &HeaderRateLimiter{}
+		l.Update(rateLimitResponse("abc", "5", "4", "2"))
+		l.Wait(context.Background(), req)
+		l.Wait(context.Background(), req)
+
+		l.Cancel(req)
+		err := l.Update(rateLimitResponse("abc", "5", "2", "2"))
+
+		require.NoError(t, err, "Reserved request failed")
+		require.Zero(t, l.buckets["abc"].inflight, "Reserved request failed")
+		require.Equal(t, 2, l.buckets["abc"].remaining, "Reserved request failed")
+	})
+
+	t.Run("Unknown route", func(t *testing.T) {
+		l := &HeaderRateLimiter{}
+
+		require.NotPanics(t, func() { l.Cancel(req) }, "Unknown route failed")
+	})
+
+	t.Run("Network error", func(t *testing.T) {
+		l := &HeaderRateLimiter{}
+		c := &Client{url: "https://discord.com/api/webhooks/1/token", client: &sequenceHttpClient{calls: 1}, limiter: MultiRateLimiter(l), maxAttempts: 1}
+		l.Update(rateLimitResponse("abc", "5", "4", "2"))
+
+		_, err := c.Send([]Message{{Content: "1"}})
+
+		require.Error(t, err, "Network error failed")
+		require.Zero(t, l.buckets["abc"].inflight, "Network error failed")
+		require.Equal(t, 3, l.buckets["abc"].remaining, "Network error failed")
+	})
+}
+
+func TestSeconds(t *testing.T) {
+	require.Equal(t, 750*time.Millisecond, seconds(0.75), "Seconds failed")
+	require.Equal(t, 1900*time.Millisecond, seconds(1.9), "Seconds failed")
+	// Rounded up so that the wait never ends early.
+	require.Equal(t, 2*time.Millisecond, seconds(0.0011), "Seconds failed")
+
+	d, err := parseSeconds("0.25")
+	require.NoError(t, err, "Seconds failed")
+	require.Equal(t, 250*time.Millisecond, d, "Seconds failed")
+
+	_, err = parseSeconds("soon")
+	require.IsType(t, &strconv.NumError{}, err, "Seconds failed")
+}
+
+func TestHeaderRateLimiterPrecision(t *testing.T) {
+	t.Run("Sub-second reset after", func(t *testing.T) {
+		l := &HeaderRateLimiter{}
+
+		err := l.Update(rateLimitResponse("abc", "5", "0", "0.75"))
+
+		require.NoError(t, err, "Sub-second reset after failed")
+		require.WithinDuration(t, time.Now().Add(750*time.Millisecond), l.buckets["abc"].reset, 20*time.Millisecond, "Sub-second reset after failed")
+	})
+
+	t.Run("Margin", func(t *testing.T) {
+		l := &HeaderRateLimiter{Margin: 250 * time.Millisecond}
+
+		err := l.Update(rateLimitResponse("abc", "5", "0", "1.9"))
+
+		require.NoError(t, err, "Margin failed")
+		require.WithinDuration(t, time.Now().Add(2150*time.Millisecond), l.buckets["abc"].reset, 20*time.Millisecond, "Margin failed")
+		require.Equal(t, 1900*time.Millisecond, l.buckets["abc"].resetAfter.Round(10*time.Millisecond), "Margin failed")
+	})
+
+	t.Run("Jitter", func(t *testing.T) {
+		l := &HeaderRateLimiter{}
+		require.Equal(t, time.Duration(0), l.jitter(), "Jitter failed")
+
+		l.Jitter = 10 * time.Millisecond
+		for i := 0; i < 100; i++ {
+			j := l.jitter()
+			require.GreaterOrEqual(t, j, time.Duration(0), "Jitter failed")
+			require.LessOrEqual(t, j, l.Jitter, "Jitter failed")
+		}
+	})
+
+	t.Run("Wait with margin", func(t *testing.T) {
+		l := &HeaderRateLimiter{Margin: 20 * time.Millisecond}
+		l.Update(rateLimitResponse("abc", "5", "0", "0.01"))
+		req := httptest.NewRequest(http.MethodPost, "/api/webhooks/1/token", nil)
+		start := time.Now()
+
+		err := l.Wait(context.Background(), req)
+
+		require.NoError(t, err, "Wait with margin failed")
+		require.GreaterOrEqual(t, time.Since(start), 25*time.Millisecond, "Wait with margin failed")
+	})
+}
+
+func TestHeaderRateLimiterResetTime(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+
+	t.Run("Reset after only", func(t *testing.T) {
+		l := &HeaderRateLimiter{}
+
+		reset, err := l.resetTime("1.5", "", "", now)
+
+		require.NoError(t, err, "Reset after only failed")
+		require.Equal(t, now.Add(1500*time.Millisecond), reset, "Reset after only failed")
+	})
+
+	t.Run("Skew measured from both headers", func(t *testing.T) {
+		l := &HeaderRateLimiter{}
+
+		// Discord clock is 3 seconds ahead.
+		reset, err := l.resetTime("1.5", "1700000004.5", "", now)
+
+		require.NoError(t, err, "Skew measured from both headers failed")
+		require.Equal(t, now.Add(1500*time.Millisecond), reset, "Skew measured from both headers failed")
+		require.Equal(t, 3*time.Second, l.skew, "Skew measured from both headers failed")
+	})
+
+	t.Run("Epoch corrected by measured skew", func(t *testing.T) {
+		l := &HeaderRateLimiter{skew: 3 * time.Second, skewSet: true}
+
+		reset, err := l.resetTime("", "1700000005.25", "Tue, 14 Nov 2023 22:14:20 GMT", now)
+
+		require.NoError(t, err, "Epoch corrected by measured skew failed")
+		require.Equal(t, now.Add(2250*time.Millisecond), reset, "Epoch corrected by measured skew failed")
+	})
+
+	t.Run("Epoch corrected by Date", func(t *testing.T) {
+		l := &HeaderRateLimiter{}
+		date := now.Add(-5 * time.Second).UTC().Format(http.TimeFormat)
+
+		reset, err := l.resetTime("", "1700000001", date, now)
+
+		require.NoError(t, err, "Epoch corrected by Date failed")
+		require.Equal(t, now.Add(6*time.Second), reset, "Epoch corrected by Date failed")
+	})
+
+	t.Run("Date offset within precision", func(t *testing.T) {
+		l := &HeaderRateLimiter{}
+		date := now.UTC().Format(http.TimeFormat)
+
+		reset, err := l.resetTime("", "1700000001", date, now.Add(500*time.Millisecond))
+
+		require.NoError(t, err, "Date offset within precision failed")
+		require.Equal(t, now.Add(time.Second), reset, "Date offset within precision failed")
+	})
+
+	t.Run("Epoch error", func(t *testing.T) {
+		l := &HeaderRateLimiter{}
+
+		_, err := l.resetTime("1", "soon", "", now)
+
+		require.IsType(t, &strconv.NumError{}, err, "Epoch error failed")
+	})
 
-		err := handleRateLimit(header)
+	t.Run("Update uses epoch", func(t *testing.T) {
+		l := &HeaderRateLimiter{}
+		resp := rateLimitResponse("abc", "5", "0", "")
+		resp.Header.Del("x-ratelimit-reset-after")
+		resp.Header.Set("x-ratelimit-reset", strconv.FormatInt(time.Now().Add(2*time.Second).Unix(), 10))
 
-		require.Equal(t, nil, err, "Return nil after sleep failed")
+		err := l.Update(resp)
+
+		require.NoError(t, err, "Update uses epoch failed")
+		require.WithinDuration(t, time.Now().Add(2*time.Second), l.buckets["abc"].reset, time.Second, "Update uses epoch failed")
+	})
+}
+
+func TestTokenBucket(t *testing.T) {
+	post := httptest.NewRequest(http.MethodPost, "/", nil)
+
+	t.Run("Burst then wait for refill", func(t *testing.T) {
+		b := NewTokenBucket(2, 100*time.Millisecond)
+		start := time.Now()
+
+		require.NoError(t, b.Wait(context.Background(), post))
+		require.NoError(t, b.Wait(context.Background(), post))
+		require.Less(t, time.Since(start), 20*time.Millisecond, "Burst failed")
+
+		require.NoError(t, b.Wait(context.Background(), post))
+		require.GreaterOrEqual(t, time.Since(start), 40*time.Millisecond, "Wait for refill failed")
+	})
+
+	t.Run("Only POST takes a token", func(t *testing.T) {
+		b := NewTokenBucket(1, time.Minute)
+		get := httptest.NewRequest(http.MethodGet, "/", nil)
+
+		require.NoError(t, b.Wait(context.Background(), get))
+		require.NoError(t, b.Wait(context.Background(), post))
+		require.NoError(t, b.Wait(context.Background(), get))
+	})
+
+	t.Run("Context done", func(t *testing.T) {
+		b := NewTokenBucket(1, time.Minute)
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		b.Wait(ctx, post)
+
+		err := b.Wait(ctx, post)
+
+		require.ErrorIs(t, err, context.DeadlineExceeded, "Context done failed")
 	})
+
+	t.Run("Invalid arguments", func(t *testing.T) {
+		for _, b := range []*TokenBucket{NewTokenBucket(0, time.Minute), NewTokenBucket(-1, 0)} {
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+
+			first := b.Wait(ctx, post)
+			second := b.Wait(ctx, post)
+
+			cancel()
+			require.NoError(t, first, "Invalid arguments failed")
+			require.ErrorIs(t, second, context.DeadlineExceeded, "Invalid arguments failed")
+			require.Equal(t, 1/ChannelMessageWindow.Seconds(), b.rate, "Invalid arguments failed")
+		}
+	})
+
+	t.Run("Channel limit", func(t *testing.T) {
+		b := NewChannelRateLimiter()
+
+		require.Equal(t, float64(ChannelMessageLimit), b.tokens, "Channel limit failed")
+		require.NoError(t, b.Update(&http.Response{}), "Channel limit failed")
+	})
+}
+
+type limiterMock struct {
+	waits   int
+	updates int
+	err     error
+}
+
+func (m *limiterMock) Wait(ctx context.Context, req *http.Request) error {
+	m.waits++
+	return m.err
+}
+
+func (m *limiterMock) Update(resp *http.Response) error {
+	m.updates++
+	return m.err
+}
+
+func TestMultiRateLimiter(t *testing.T) {
+	t.Run("All limiters", func(t *testing.T) {
+		a, b := &limiterMock{}, &limiterMock{}
+		l := MultiRateLimiter(a, b)
+
+		require.NoError(t, l.Wait(context.Background(), nil))
+		require.NoError(t, l.Update(nil))
+		require.Equal(t, 1, b.waits, "All limiters failed")
+		require.Equal(t, 1, b.updates, "All limiters failed")
+	})
+
+	t.Run("Stop on error", func(t *testing.T) {
+		a, b := &limiterMock{err: errors.New("test")}, &limiterMock{}
+		l := MultiRateLimiter(a, b)
+
+		require.EqualError(t, l.Wait(context.Background(), nil), "test")
+		require.EqualError(t, l.Update(nil), "test")
+		require.Equal(t, 0, b.waits, "Stop on error failed")
+		require.Equal(t, 0, b.updates, "Stop on error failed")
+	})
+}
+
+func TestClientRateLimiter(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	m := &limiterMock{}
+	c, _ := NewClient(http.DefaultClient, "https://discord.com/api/webhooks/123/token", WithRateLimiter(m))
+	c.url = server.URL
+
+	_, err := c.Send([]Message{{Content: "1"}, {Content: "2"}})
+
+	require.NoError(t, err, "Client rate limiter failed")
+	require.Equal(t, 2, m.waits, "Client rate limiter failed")
+	require.Equal(t, 2, m.updates, "Client rate limiter failed")
+}
+
+func TestSleep(t *testing.T) {
+	t.Run("Zero duration", func(t *testing.T) {
+		err := sleep(context.Background(), 0)
+
+		require.NoError(t, err, "Zero duration failed")
+	})
+
+	t.Run("Elapsed", func(t *testing.T) {
+		start := time.Now()
+
+		err := sleep(context.Background(), 10*time.Millisecond)
+
+		require.NoError(t, err, "Elapsed failed")
+		require.GreaterOrEqual(t, time.Since(start), 10*time.Millisecond, "Elapsed failed")
+	})
+
+	t.Run("Context done", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		err := sleep(ctx, time.Minute)
+
+		require.ErrorIs(t, err, context.Canceled, "Context done failed")
+	})
+}
+
+func TestParseRateLimit(t *testing.T) {
+	t.Run("All headers", func(t *testing.T) {
+		header := http.Header{}
+		header.Set("x-ratelimit-bucket", "abc")
+		header.Set("x-ratelimit-limit", "5")
+		header.Set("x-ratelimit-remaining", "3")
+		header.Set("x-ratelimit-reset", "1700000000.25")
+		header.Set("x-ratelimit-reset-after", "0.75")
+		header.Set("x-ratelimit-global", "true")
+		header.Set("x-ratelimit-scope", "shared")
+
+		rl := parseRateLimit(header)
+
+		require.Equal(t, RateLimit{
+			Bucket:     "abc",
+			Limit:      5,
+			Remaining:  3,
+			Reset:      time.Unix(1700000000, 250000000),
+			ResetAfter: 750 * time.Millisecond,
+			Global:     true,
+			Scope:      "shared",
+		}, rl, "All headers failed")
+	})
+
+	t.Run("No headers", func(t *testing.T) {
+		rl := parseRateLimit(http.Header{})
+
+		require.Equal(t, RateLimit{}, rl, "No headers failed")
+	})
+}
+
+func TestParseTooManyRequests(t *testing.T) {
+	t.Run("Body retry_after", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		rr.Header().Set("Retry-After", "1")
+		rr.WriteHeader(http.StatusTooManyRequests)
+		rr.Write([]byte(`{"message": "You are being rate limited.", "retry_after": 0.25, "global": true}`))
+
+		limitErr, err := parseTooManyRequests(rr.Result())
+
+		require.NoError(t, err, "Body retry_after failed")
+		require.Equal(t, 250*time.Millisecond, limitErr.RetryAfter, "Body retry_after failed")
+		require.True(t, limitErr.Global, "Body retry_after failed")
+	})
+
+	t.Run("Retry-After header", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		rr.Header().Set("Retry-After", "2")
+		rr.Header().Set("X-RateLimit-Global", "true")
+		rr.WriteHeader(http.StatusTooManyRequests)
+
+		limitErr, err := parseTooManyRequests(rr.Result())
+
+		require.NoError(t, err, "Retry-After header failed")
+		require.Equal(t, 2*time.Second, limitErr.RetryAfter, "Retry-After header failed")
+		require.True(t, limitErr.Global, "Retry-After header failed")
+	})
+
+	t.Run("No wait", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		rr.WriteHeader(http.StatusTooManyRequests)
+
+		limitErr, err := parseTooManyRequests(rr.Result())
+
+		require.NoError(t, err, "No wait failed")
+		require.Equal(t, time.Duration(0), limitErr.RetryAfter, "No wait failed")
+	})
+
+	t.Run("Retry-After error", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		rr.Header().Set("Retry-After", "soon")
+		rr.WriteHeader(http.StatusTooManyRequests)
+
+		_, err := parseTooManyRequests(rr.Result())
+
+		require.IsType(t, &strconv.NumError{}, err, "Retry-After error failed")
+	})
+}
+
+func TestRateLimitError(t *testing.T) {
+	err := &RateLimitError{RetryAfter: time.Second, Global: true, Attempts: 3}
+
+	require.EqualError(t, err, "Discord API error: global rate limit hit after 3 attempts, retry after 1s")
 }
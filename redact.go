@@ -0,0 +1,88 @@
+package messenger
+
+import (
+	"errors"
+	"log/slog"
+	"net/url"
+	"strings"
+)
+
+// redacted replaces the webhook token in errors and printed urls.
+const redacted = "REDACTED"
+
+// redactedError hides the token in the message of err while keeping err
+// reachable with errors.Is and errors.As.
+type redactedError struct {
+	err error
+	msg string
+}
+
+func (e *redactedError) Error() string {
+	return e.msg
+}
+
+func (e *redactedError) Unwrap() error {
+	return e.err
+}
+
+// redact replaces the token of the Client in s.
+func (c *Client) redact(s string) string {
+	if c.token == "" {
+		return s
+	}
+	return strings.ReplaceAll(s, c.token, redacted)
+}
+
+// redactError removes the token from err, which otherwise leaks through the
+// url of *url.Error returned by the HttpClient or the messages of Discord.
+// Errors reached with errors.As are redacted too.
+func (c *Client) redactError(err error) error {
+	if err == nil || c.token == "" {
+		return err
+	}
+	c.redactChain(err)
+	if msg := err.Error(); strings.Contains(msg, c.token) {
+		return &redactedError{err: err, msg: c.redact(msg)}
+	}
+	return err
+}
+
+// redactChain removes the token from the fields of the errors wrapped by err.
+func (c *Client) redactChain(err error) {
+	for ; err != nil; err = errors.Unwrap(err) {
+		switch e := err.(type) {
+		case *url.Error:
+			e.URL = c.redact(e.URL)
+		case *APIError:
+			e.Message = c.redact(e.Message)
+			for i := range e.Errors {
+				e.Errors[i].Message = c.redact(e.Errors[i].Message)
+			}
+		case *PartialSendError:
+			// Err is replaced when its message holds the token.
+			e.Err = c.redactError(e.Err)
+			return
+		}
+	}
+}
+
+// String returns the webhook url of the Client with the token redacted.
+func (c *Client) String() string {
+	return c.redact(c.url)
+}
+
+// LogValue implements slog.LogValuer, logging the Client as String.
+func (c *Client) LogValue() slog.Value {
+	return slog.StringValue(c.String())
+}
+
+// String returns the url of the webhook with the token redacted, use URL to
+// get the url requests are sent to.
+func (w WebhookURL) String() string {
+	return strings.Replace(w.URL(), "/"+w.Token, "/"+redacted, 1)
+}
+
+// LogValue implements slog.LogValuer, logging the webhook as String.
+func (w WebhookURL) LogValue() slog.Value {
+	return slog.StringValue(w.String())
+}
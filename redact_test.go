@@ -0,0 +1,195 @@
+package messenger
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const secretToken = "secret-token"
+
+// closedClient returns a Client of a server which is already closed, so that
+// every request fails with a *url.Error holding the webhook url.
+func closedClient() *Client {
+	server := httptest.NewServer(http.NotFoundHandler())
+	server.Close()
+	return &Client{
+		url:         server.URL + "/api/webhooks/123/" + secretToken,
+		token:       secretToken,
+		client:      http.DefaultClient,
+		maxAttempts: 1,
+		limiter:     &HeaderRateLimiter{},
+	}
+}
+
+func TestClientRedactError(t *testing.T) {
+	ctx := context.Background()
+	msgs := []Message{{Content: "1"}}
+	calls := map[string]func(c *Client) error{
+		"SendContext": func(c *Client) error {
+			_, err := c.SendContext(ctx, msgs)
+			return err
+		},
+		"Resume": func(c *Client) error {
+			_, err := c.Resume(ctx, &PartialSendError{Pending: msgs})
+			return err
+		},
+		"EditMessage": func(c *Client) error {
+			_, err := c.EditMessage(ctx, "1", msgs[0])
+			return err
+		},
+		"DeleteMessage": func(c *Client) error {
+			return c.DeleteMessage(ctx, "1")
+		},
+		"GetWebhook": func(c *Client) error {
+			_, err := c.GetWebhook(ctx)
+			return err
+		},
+		"ModifyWebhook": func(c *Client) error {
+			_, err := c.ModifyWebhook(ctx, WebhookEdit{Name: "alerts"})
+			return err
+		},
+		"DeleteWebhook": func(c *Client) error {
+			return c.DeleteWebhook(ctx)
+		},
+	}
+
+	for name, call := range calls {
+		t.Run(name, func(t *testing.T) {
+			err := call(closedClient())
+
+			var urlErr *url.Error
+			require.ErrorAs(t, err, &urlErr, name+" failed")
+			require.NotContains(t, err.Error(), secretToken, name+" failed")
+			require.Contains(t, err.Error(), redacted, name+" failed")
+		})
+	}
+
+	t.Run("Partial send", func(t *testing.T) {
+		c := closedClient()
+		c.client = &sequenceHttpClient{}
+
+		_, err := c.SendContext(ctx, []Message{{Content: "1"}, {Content: "2"}})
+
+		var partialErr *PartialSendError
+		require.ErrorAs(t, err, &partialErr, "Partial send failed")
+		require.NotContains(t, err.Error(), secretToken, "Partial send failed")
+		require.NotContains(t, partialErr.Err.Error(), secretToken, "Partial send failed")
+	})
+
+	t.Run("Partial send plain error", func(t *testing.T) {
+		c := closedClient()
+		c.client = &sequenceHttpClient{plain: true}
+
+		_, err := c.SendContext(ctx, []Message{{Content: "1"}, {Content: "2"}})
+
+		var partialErr *PartialSendError
+		require.ErrorAs(t, err, &partialErr, "Partial send plain error failed")
+		require.NotContains(t, err.Error(), secretToken, "Partial send plain error failed")
+		require.NotContains(t, partialErr.Err.Error(), secretToken, "Partial send plain error failed")
+		require.Contains(t, partialErr.Err.Error(), redacted, "Partial send plain error failed")
+	})
+
+	t.Run("Message", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"message": "Invalid URL ` + r.URL.Path + `", "code": 50035, "errors": {"url": {"_errors": [{"code": "URL_TYPE_INVALID_URL", "message": "Not a well formed URL ` + r.URL.Path + `"}]}}}`))
+		}))
+		defer server.Close()
+		c := &Client{url: server.URL + "/" + secretToken, token: secretToken, client: http.DefaultClient, maxAttempts: 1, limiter: &HeaderRateLimiter{}}
+
+		_, err := c.GetWebhook(ctx)
+
+		var apiErr *APIError
+		require.ErrorAs(t, err, &apiErr, "Message failed")
+		require.Equal(t, CodeInvalidFormBody, apiErr.Code, "Message failed")
+		require.EqualError(t, err, "Discord API error 50035: Invalid URL /"+redacted+" (url: Not a well formed URL /"+redacted+")", "Message failed")
+		require.Equal(t, "Invalid URL /"+redacted, apiErr.Message, "Message failed")
+		require.Equal(t, "Not a well formed URL /"+redacted, apiErr.Errors[0].Message, "Message failed")
+	})
+
+	t.Run("No token", func(t *testing.T) {
+		err := errors.New(secretToken)
+
+		redactedErr := (&Client{}).redactError(err)
+
+		require.Equal(t, err, redactedErr, "No token failed")
+	})
+
+	t.Run("Nil", func(t *testing.T) {
+		err := closedClient().redactError(nil)
+
+		require.NoError(t, err, "Nil failed")
+	})
+}
+
+// sequenceHttpClient answers the first request and fails the following ones
+// with the error a closed connection would return, or a plain error holding
+// the url.
+type sequenceHttpClient struct {
+	calls int
+	plain bool
+}
+
+func (s *sequenceHttpClient) Do(req *http.Request) (*http.Response, error) {
+	s.calls++
+	if s.calls == 1 {
+		return &http.Response{StatusCode: http.StatusNoContent, Header: http.Header{}, Body: http.NoBody}, nil
+	}
+	if s.plain {
+		return nil, errors.New("Post " + req.URL.String() + ": connection reset by peer")
+	}
+	return nil, &url.Error{Op: "Post", URL: req.URL.String(), Err: errors.New("connection reset by peer")}
+}
+
+func TestClientString(t *testing.T) {
+	c, _ := NewClient(http.DefaultClient, "https://discord.com/api/webhooks/123/"+secretToken)
+	want := "https://discord.com/api/webhooks/123/" + redacted
+
+	t.Run("String", func(t *testing.T) {
+		require.Equal(t, want, c.String(), "String failed")
+		require.Equal(t, want, fmt.Sprint(c), "String failed")
+	})
+
+	t.Run("LogValue", func(t *testing.T) {
+		var buf bytes.Buffer
+		logger := slog.New(slog.NewTextHandler(&buf, nil))
+
+		logger.Info("sending", "client", c)
+
+		require.NotContains(t, buf.String(), secretToken, "LogValue failed")
+		require.Contains(t, buf.String(), "client="+want, "LogValue failed")
+	})
+}
+
+func TestWebhookURLString(t *testing.T) {
+	w := WebhookURL{ID: "123", Token: secretToken, APIVersion: 10}
+	want := "https://discord.com/api/v10/webhooks/123/" + redacted
+
+	t.Run("String", func(t *testing.T) {
+		require.Equal(t, want, w.String(), "String failed")
+		require.Equal(t, want, fmt.Sprintf("%v", w), "String failed")
+	})
+
+	t.Run("LogValue", func(t *testing.T) {
+		var buf bytes.Buffer
+		logger := slog.New(slog.NewJSONHandler(&buf, nil))
+
+		logger.Info("sending", "webhook", w)
+
+		require.NotContains(t, buf.String(), secretToken, "LogValue failed")
+		require.Contains(t, buf.String(), `"webhook":"`+want+`"`, "LogValue failed")
+	})
+
+	t.Run("URL", func(t *testing.T) {
+		require.Contains(t, w.URL(), secretToken, "URL failed")
+	})
+}
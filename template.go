@@ -0,0 +1,80 @@
+package messenger
+
+// WithMessageTemplate merges m into every message sent. A message takes the
+// Username, AvatarURL and AllowedMentions of m when it leaves them empty, and
+// the Flags of m are added to its own. Other fields of m are ignored, use
+// WithEmbedTemplate for embeds. It replaces WithUsername, WithAvatarURL and
+// WithAllowedMentions given before it.
+func WithMessageTemplate(m Message) Option {
+	return func(c *Client) {
+		c.defaults = Message{
+			Username:        m.Username,
+			AvatarURL:       m.AvatarURL,
+			AllowedMentions: m.AllowedMentions,
+			Flags:           m.Flags,
+		}
+	}
+}
+
+// WithEmbedTemplate merges e into every embed sent. An embed takes the Author,
+// Footer, Thumbnail and Color of e when it leaves them empty, each as a whole.
+// Other fields of e are ignored. Merged embeds count towards the embed limits,
+// so messages may be divided further than without the template.
+func WithEmbedTemplate(e Embed) Option {
+	return func(c *Client) {
+		c.embed = Embed{Author: e.Author, Footer: e.Footer, Thumbnail: e.Thumbnail, Color: e.Color}
+	}
+}
+
+// applyDefaults returns a copy of msgs merged with the templates of the Client,
+// it runs before messages are divided and validated.
+func (c *Client) applyDefaults(msgs []Message) []Message {
+	applied := make([]Message, len(msgs))
+	for i, msg := range msgs {
+		applied[i] = c.mergeMessage(msg)
+	}
+	return applied
+}
+
+func (c *Client) mergeMessage(msg Message) Message {
+	if msg.Username == "" {
+		msg.Username = c.defaults.Username
+	}
+	if msg.AvatarURL == "" {
+		msg.AvatarURL = c.defaults.AvatarURL
+	}
+	return c.mergeEditable(msg)
+}
+
+// mergeEditable merges the templates into the fields of msg which an edit can
+// change, the username and avatar cannot.
+func (c *Client) mergeEditable(msg Message) Message {
+	if msg.AllowedMentions == nil {
+		msg.AllowedMentions = c.defaults.AllowedMentions
+	}
+	msg.Flags |= c.defaults.Flags
+	if len(msg.Embeds) > 0 {
+		embeds := make([]Embed, len(msg.Embeds))
+		for i, e := range msg.Embeds {
+			embeds[i] = c.mergeEmbed(e)
+		}
+		msg.Embeds = embeds
+	}
+	return msg
+}
+
+func (c *Client) mergeEmbed(e Embed) Embed {
+	if e.Author == (Author{}) {
+		e.Author = c.embed.Author
+	}
+	if e.Footer == (Footer{}) {
+		e.Footer = c.embed.Footer
+	}
+	if e.Thumbnail == (Thumbnail{}) {
+		e.Thumbnail = c.embed.Thumbnail
+	}
+	if e.Color == 0 {
+		e.Color = c.embed.Color
+	}
+	return e
+}
@@ -0,0 +1,165 @@
+package messenger
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWithMessageTemplate(t *testing.T) {
+	c := &Client{}
+	WithUsername("ignored")(c)
+
+	WithMessageTemplate(Message{
+		Content:  "ignored",
+		Username: "alerts",
+		Flags:    FlagSuppressEmbeds,
+		Embeds:   []Embed{{Title: "ignored"}},
+	})(c)
+
+	require.Equal(t, Message{Username: "alerts", Flags: FlagSuppressEmbeds}, c.defaults, "With message template failed")
+}
+
+func TestWithEmbedTemplate(t *testing.T) {
+	c := &Client{}
+
+	WithEmbedTemplate(Embed{Title: "ignored", Color: 0xff0000, Footer: Footer{Text: "prod"}, Fields: []Field{{Name: "a", Value: "b"}}})(c)
+
+	require.Equal(t, Embed{Color: 0xff0000, Footer: Footer{Text: "prod"}}, c.embed, "With embed template failed")
+}
+
+func TestClientApplyDefaults(t *testing.T) {
+	t.Run("No defaults", func(t *testing.T) {
+		msgs := []Message{{Content: "1"}}
+
+		applied := (&Client{}).applyDefaults(msgs)
+
+		require.Equal(t, msgs, applied, "No defaults failed")
+	})
+
+	t.Run("Override", func(t *testing.T) {
+		c := &Client{defaults: Message{Username: "alerts", AvatarURL: "a.png", AllowedMentions: &AllowedMentions{}}}
+		mentions := &AllowedMentions{Parse: []AllowedMentionType{AllowedMentionUsers}}
+		msgs := []Message{
+			{Content: "1"},
+			{Content: "2", Username: "deploys", AvatarURL: "b.png", AllowedMentions: mentions},
+		}
+
+		applied := c.applyDefaults(msgs)
+
+		require.Equal(t, Message{Content: "1", Username: "alerts", AvatarURL: "a.png", AllowedMentions: &AllowedMentions{}}, applied[0], "Override failed")
+		require.Equal(t, msgs[1], applied[1], "Override failed")
+		require.Empty(t, msgs[0].Username, "Override failed")
+	})
+
+	t.Run("Sent", func(t *testing.T) {
+		var payload map[string]interface{}
+		var userAgent string
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			userAgent = r.UserAgent()
+			json.NewDecoder(r.Body).Decode(&payload)
+		}))
+		defer server.Close()
+		c, _ := New(server.URL+"/api/webhooks/123/token", WithBaseURL(server.URL+"/api"),
+			WithUserAgent("alerts/1.0"), WithUsername("alerts"), WithAllowedMentions(AllowedMentions{}))
+
+		_, err := c.Send([]Message{{Content: "@everyone"}})
+
+		require.NoError(t, err, "Sent failed")
+		require.Equal(t, "alerts/1.0", userAgent, "Sent failed")
+		require.Equal(t, "alerts", payload["username"], "Sent failed")
+		require.Equal(t, map[string]interface{}{}, payload["allowed_mentions"], "Sent failed")
+	})
+}
+
+func TestClientMergeMessage(t *testing.T) {
+	c := &Client{}
+	WithMessageTemplate(Message{Flags: FlagSuppressNotifications})(c)
+	WithEmbedTemplate(Embed{
+		Author:    Author{Name: "CI"},
+		Footer:    Footer{Text: "prod"},
+		Thumbnail: Thumbnail{URL: "https://example.com/t.png"},
+		Color:     0xff0000,
+	})(c)
+
+	t.Run("Empty fields", func(t *testing.T) {
+		msg := Message{Embeds: []Embed{{Title: "Deploy"}}}
+
+		merged := c.mergeMessage(msg)
+
+		require.Equal(t, FlagSuppressNotifications, merged.Flags, "Empty fields failed")
+		require.Equal(t, Embed{
+			Title:     "Deploy",
+			Author:    Author{Name: "CI"},
+			Footer:    Footer{Text: "prod"},
+			Thumbnail: Thumbnail{URL: "https://example.com/t.png"},
+			Color:     0xff0000,
+		}, merged.Embeds[0], "Empty fields failed")
+		require.Equal(t, Embed{Title: "Deploy"}, msg.Embeds[0], "Empty fields failed")
+	})
+
+	t.Run("Set fields", func(t *testing.T) {
+		e := Embed{
+			Title:     "Deploy",
+			Author:    Author{IconURL: "https://example.com/a.png"},
+			Footer:    Footer{Text: "staging"},
+			Thumbnail: Thumbnail{URL: "https://example.com/u.png"},
+			Color:     0x00ff00,
+		}
+
+		merged := c.mergeMessage(Message{Embeds: []Embed{e}, Flags: FlagSuppressEmbeds})
+
+		require.Equal(t, FlagSuppressEmbeds|FlagSuppressNotifications, merged.Flags, "Set fields failed")
+		require.Equal(t, e, merged.Embeds[0], "Set fields failed")
+	})
+}
+
+func TestClientSendTemplate(t *testing.T) {
+	var payloads []Message
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var msg Message
+		json.NewDecoder(r.Body).Decode(&msg)
+		payloads = append(payloads, msg)
+	}))
+	defer server.Close()
+	c := &Client{url: server.URL, client: http.DefaultClient}
+	WithEmbedTemplate(Embed{Footer: Footer{Text: strings.Repeat("f", 100)}})(c)
+	// Both embeds fit in one message without the footer of the template.
+	embeds := []Embed{
+		{Description: strings.Repeat("a", 2950)},
+		{Description: strings.Repeat("b", 2950)},
+	}
+
+	results, err := c.Send([]Message{{Embeds: embeds}})
+
+	require.NoError(t, err, "Send template failed")
+	require.Len(t, results, 2, "Send template failed")
+	require.Len(t, payloads, 2, "Send template failed")
+	require.Equal(t, strings.Repeat("f", 100), payloads[1].Embeds[0].Footer.Text, "Send template failed")
+}
+
+func TestClientEditTemplate(t *testing.T) {
+	var payload Message
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&payload)
+		w.Write([]byte(`{"id": "10"}`))
+	}))
+	defer server.Close()
+	c := &Client{url: server.URL + "/api/webhooks/1/token", client: http.DefaultClient}
+	WithMessageTemplate(Message{Username: "alerts", Flags: FlagSuppressNotifications, AllowedMentions: &AllowedMentions{}})(c)
+	WithEmbedTemplate(Embed{Author: Author{Name: "CI"}, Footer: Footer{Text: "production"}, Color: 0xe74c3c})(c)
+
+	_, err := c.EditMessage(context.Background(), "10", Message{Embeds: []Embed{{Title: "Deploy done"}}})
+
+	require.NoError(t, err, "Edit template failed")
+	require.Equal(t, Message{
+		Embeds:          []Embed{{Title: "Deploy done", Author: Author{Name: "CI"}, Footer: Footer{Text: "production"}, Color: 0xe74c3c}},
+		AllowedMentions: &AllowedMentions{},
+		Flags:           FlagSuppressNotifications,
+	}, payload, "Edit template failed")
+}
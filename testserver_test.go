@@ -0,0 +1,85 @@
+package messenger
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+)
+
+// testServer records the requests it accepts. Responses take their status from
+// statuses in order, 204 once exhausted, and only requests answered 204 are
+// recorded. Requests wait for release to be closed when it is not nil, received
+// gets the content of each request as it arrives, requests are not held when
+// it is full.
+type testServer struct {
+	*httptest.Server
+	received chan string
+
+	mu       sync.Mutex
+	statuses []int
+	bodies   []string
+	queries  []string
+}
+
+func newTestServer(release chan struct{}, statuses ...int) *testServer {
+	s := &testServer{received: make(chan string, 100), statuses: statuses}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		select {
+		case s.received <- content(string(b)):
+		default:
+		}
+		if release != nil {
+			<-release
+		}
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		status := http.StatusNoContent
+		if len(s.statuses) > 0 {
+			status, s.statuses = s.statuses[0], s.statuses[1:]
+		}
+		if status != http.StatusNoContent {
+			w.WriteHeader(status)
+			w.Write([]byte(`{"message": "error", "code": 50035, "retry_after": 0.001}`))
+			return
+		}
+		s.bodies = append(s.bodies, string(b))
+		s.queries = append(s.queries, r.URL.RawQuery)
+		w.WriteHeader(status)
+	}))
+	return s
+}
+
+// content returns the content of a JSON message body.
+func content(body string) string {
+	var msg Message
+	json.Unmarshal([]byte(body), &msg)
+	return msg.Content
+}
+
+func (s *testServer) Bodies() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.bodies...)
+}
+
+// Contents returns the content of the recorded messages.
+func (s *testServer) Contents() []string {
+	var contents []string
+	for _, b := range s.Bodies() {
+		contents = append(contents, content(b))
+	}
+	return contents
+}
+
+func (s *testServer) Queries() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.queries...)
+}
+
+func (s *testServer) client() *Client {
+	return &Client{url: s.URL, client: http.DefaultClient, maxAttempts: 1}
+}
@@ -2,7 +2,8 @@ package messenger
 
 import (
 	"errors"
-	"strings"
+
+	"github.com/qiyihuang/messenger/internal/validation"
 )
 
 // Limits Discord API enforces on webhook message.
@@ -22,6 +23,10 @@ const (
 	FieldNameLimit        = 256
 	FieldValueLimit       = 1024
 	FooterTextLimit       = 2048
+	ThreadNameLimit       = 100
+	AppliedTagNumLimit    = 5
+	// Applies to the users and roles of allowed mentions separately.
+	AllowedMentionNumLimit = 100
 )
 
 func limitError(field string) error {
@@ -98,11 +103,27 @@ func validateEmbed(e Embed) error {
 	return nil
 }
 
-// validateURL checks Discord webhook url validity.
-func validateURL(url string) error {
-	const webhookPrefix = "https://discord.com/api/webhooks/"
-	if !strings.HasPrefix(url, webhookPrefix) {
-		return errors.New("invalid webhook URL")
+func validateAllowedMentions(a AllowedMentions) error {
+	for _, t := range a.Parse {
+		switch t {
+		case AllowedMentionRoles:
+			if len(a.Roles) > 0 {
+				return errors.New("Allowed mentions cannot parse roles and list roles")
+			}
+		case AllowedMentionUsers:
+			if len(a.Users) > 0 {
+				return errors.New("Allowed mentions cannot parse users and list users")
+			}
+		case AllowedMentionEveryone:
+		default:
+			return errors.New("Allowed mention type " + string(t) + " is invalid")
+		}
+	}
+	if len(a.Users) > AllowedMentionNumLimit {
+		return limitError("Allowed mention user number")
+	}
+	if len(a.Roles) > AllowedMentionNumLimit {
+		return limitError("Allowed mention role number")
 	}
 	return nil
 }
@@ -119,6 +140,23 @@ func validateMessage(m Message) error {
 	if len(m.Embeds) > MessageEmbedNumLimit {
 		return limitError("Message embed number")
 	}
+	if m.ThreadID != "" && m.ThreadName != "" {
+		return errors.New("Message cannot have both thread ID and thread name")
+	}
+	if len(m.ThreadName) > ThreadNameLimit {
+		return limitError("Thread name")
+	}
+	if len(m.AppliedTags) > AppliedTagNumLimit {
+		return limitError("Applied tag number")
+	}
+	if m.Flags&^(FlagSuppressEmbeds|FlagSuppressNotifications) != 0 {
+		return errors.New("Message flags only support suppress embeds and suppress notifications")
+	}
+	if m.AllowedMentions != nil {
+		if err := validateAllowedMentions(*m.AllowedMentions); err != nil {
+			return err
+		}
+	}
 
 	for _, embed := range m.Embeds {
 		if err := validateEmbed(embed); err != nil {
@@ -128,6 +166,13 @@ func validateMessage(m Message) error {
 	return nil
 }
 
+func init() {
+	// Lets messengertest reject what Discord would.
+	validation.Message = func(msg interface{}) error {
+		return validateMessage(msg.(Message))
+	}
+}
+
 // validateRequest calls validateURL and validateMessage to check validity of a Request.
 func validateMessages(msgs []Message) error {
 	if len(msgs) == 0 {
@@ -5,6 +5,7 @@ import (
 	"strings"
 	"testing"
 
+	"github.com/qiyihuang/messenger/internal/validation"
 	"github.com/stretchr/testify/require"
 )
 
@@ -213,19 +214,54 @@ func TestValidateEmbed(t *testing.T) {
 	})
 }
 
-func TestValidateURL(t *testing.T) {
-	t.Run("Invalid", func(t *testing.T) {
-		url := "wrong"
+func TestValidateAllowedMentions(t *testing.T) {
+	t.Run("Parse roles and list roles", func(t *testing.T) {
+		a := AllowedMentions{Parse: []AllowedMentionType{AllowedMentionRoles}, Roles: []string{"1"}}
 
-		err := validateURL(url)
+		err := validateAllowedMentions(a)
 
-		require.Equal(t, errors.New("invalid webhook URL"), err, "Invalid failed")
+		require.EqualError(t, err, "Allowed mentions cannot parse roles and list roles")
+	})
+
+	t.Run("Parse users and list users", func(t *testing.T) {
+		a := AllowedMentions{Parse: []AllowedMentionType{AllowedMentionUsers}, Users: []string{"1"}}
+
+		err := validateAllowedMentions(a)
+
+		require.EqualError(t, err, "Allowed mentions cannot parse users and list users")
+	})
+
+	t.Run("Invalid type", func(t *testing.T) {
+		a := AllowedMentions{Parse: []AllowedMentionType{"here"}}
+
+		err := validateAllowedMentions(a)
+
+		require.EqualError(t, err, "Allowed mention type here is invalid")
+	})
+
+	t.Run("User number limit", func(t *testing.T) {
+		a := AllowedMentions{Users: make([]string, AllowedMentionNumLimit+1)}
+
+		err := validateAllowedMentions(a)
+
+		require.Equal(t, errors.New("Allowed mention user number"+errorMsg), err, "User number limit failed")
+	})
+
+	t.Run("Role number limit", func(t *testing.T) {
+		a := AllowedMentions{Roles: make([]string, AllowedMentionNumLimit+1)}
+
+		err := validateAllowedMentions(a)
+
+		require.Equal(t, errors.New("Allowed mention role number"+errorMsg), err, "Role number limit failed")
 	})
 
 	t.Run("Pass", func(t *testing.T) {
-		url := "https://discord.com/api/webhooks/"
+		a := AllowedMentions{
+			Parse: []AllowedMentionType{AllowedMentionUsers, AllowedMentionEveryone},
+			Roles: []string{"1"},
+		}
 
-		err := validateURL(url)
+		err := validateAllowedMentions(a)
 
 		require.Equal(t, nil, err, "Pass failed")
 	})
@@ -257,6 +293,46 @@ func TestValidateMessage(t *testing.T) {
 		require.Equal(t, errors.New("Message embed number"+errorMsg), err, "Embed number limit failed")
 	})
 
+	t.Run("Thread ID and name", func(t *testing.T) {
+		msg := Message{Content: "Ok", ThreadID: "1", ThreadName: "post"}
+
+		err := validateMessage(msg)
+
+		require.EqualError(t, err, "Message cannot have both thread ID and thread name")
+	})
+
+	t.Run("Thread name limit", func(t *testing.T) {
+		msg := Message{Content: "Ok", ThreadName: strings.Repeat("t", ThreadNameLimit+1)}
+
+		err := validateMessage(msg)
+
+		require.Equal(t, errors.New("Thread name"+errorMsg), err, "Thread name limit failed")
+	})
+
+	t.Run("Applied tag number limit", func(t *testing.T) {
+		msg := Message{Content: "Ok", ThreadName: "post", AppliedTags: []string{"1", "2", "3", "4", "5", "6"}}
+
+		err := validateMessage(msg)
+
+		require.Equal(t, errors.New("Applied tag number"+errorMsg), err, "Applied tag number limit failed")
+	})
+
+	t.Run("Unsupported flags", func(t *testing.T) {
+		msg := Message{Content: "Ok", Flags: FlagSuppressEmbeds | 1<<6}
+
+		err := validateMessage(msg)
+
+		require.EqualError(t, err, "Message flags only support suppress embeds and suppress notifications")
+	})
+
+	t.Run("Validate allowed mentions", func(t *testing.T) {
+		msg := Message{Content: "Ok", AllowedMentions: &AllowedMentions{Parse: []AllowedMentionType{"here"}}}
+
+		err := validateMessage(msg)
+
+		require.EqualError(t, err, "Allowed mention type here is invalid")
+	})
+
 	t.Run("Validate embeds", func(t *testing.T) {
 		embeds := []Embed{{}, {Title: strings.Repeat("t", EmbedTitleLimit+1)}}
 		msg := Message{Embeds: embeds}
@@ -275,6 +351,11 @@ func TestValidateMessage(t *testing.T) {
 	})
 }
 
+func TestValidationMessage(t *testing.T) {
+	require.EqualError(t, validation.Message(Message{}), "Message must have either content or embeds")
+	require.NoError(t, validation.Message(Message{Content: "Ok"}), "Validation message failed")
+}
+
 func TestValidateMessages(t *testing.T) {
 	t.Run("No message", func(t *testing.T) {
 		msgs := []Message{}
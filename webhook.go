@@ -0,0 +1,96 @@
+package messenger
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+)
+
+// WebhookNameLimit is the length limit of a webhook name.
+const WebhookNameLimit = 80
+
+// Webhook represents the webhook object the Client sends messages with.
+// https://discord.com/developers/docs/resources/webhook#webhook-object
+type Webhook struct {
+	ID            string `json:"id"`
+	Type          int    `json:"type"`
+	GuildID       string `json:"guild_id,omitempty"`
+	ChannelID     string `json:"channel_id"`
+	Name          string `json:"name"`
+	Avatar        string `json:"avatar"` // Hash of the default avatar.
+	ApplicationID string `json:"application_id,omitempty"`
+}
+
+// WebhookEdit holds the changes to a webhook, empty fields are left unchanged.
+type WebhookEdit struct {
+	// Name is the default username of messages.
+	Name string `json:"name,omitempty"`
+	// Avatar is the default avatar image as a data URI, see AvatarData.
+	Avatar string `json:"avatar,omitempty"`
+}
+
+// AvatarData encodes an image into the data URI Discord expects for avatars.
+// contentType is one of "image/jpeg", "image/png" or "image/gif".
+// https://discord.com/developers/docs/reference#image-data
+func AvatarData(contentType string, image []byte) string {
+	return "data:" + contentType + ";base64," + base64.StdEncoding.EncodeToString(image)
+}
+
+func validateWebhookEdit(e WebhookEdit) error {
+	if e == (WebhookEdit{}) {
+		return errors.New("Webhook edit must change name or avatar")
+	}
+	if len(e.Name) > WebhookNameLimit {
+		return limitError("Webhook name")
+	}
+	return nil
+}
+
+// GetWebhook returns the webhook of the Client, which fails with CodeUnknownWebhook
+// once the webhook is deleted.
+func (c *Client) GetWebhook(ctx context.Context) (_ *Webhook, err error) {
+	defer func() { err = c.redactError(err) }()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.url, nil)
+	if err != nil {
+		return nil, err
+	}
+	var w Webhook
+	if err := c.do(req, &SendResult{}, &w); err != nil {
+		return nil, err
+	}
+	return &w, nil
+}
+
+// ModifyWebhook renames the webhook or changes its default avatar and returns
+// the modified webhook.
+func (c *Client) ModifyWebhook(ctx context.Context, edit WebhookEdit) (_ *Webhook, err error) {
+	defer func() { err = c.redactError(err) }()
+	if err := validateWebhookEdit(edit); err != nil {
+		return nil, err
+	}
+	// Marshal would never fail since WebhookEdit only holds strings.
+	payload, _ := json.Marshal(edit)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPatch, c.url, bytes.NewBuffer(payload))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Add("Content-Type", "application/json")
+	var w Webhook
+	if err := c.do(req, &SendResult{}, &w); err != nil {
+		return nil, err
+	}
+	return &w, nil
+}
+
+// DeleteWebhook deletes the webhook, the Client cannot send messages afterwards.
+func (c *Client) DeleteWebhook(ctx context.Context) (err error) {
+	defer func() { err = c.redactError(err) }()
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, c.url, nil)
+	if err != nil {
+		return err
+	}
+	return c.do(req, &SendResult{}, nil)
+}
@@ -0,0 +1,158 @@
+package messenger
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAvatarData(t *testing.T) {
+	data := AvatarData("image/png", []byte("png"))
+
+	require.Equal(t, "data:image/png;base64,cG5n", data, "Avatar data failed")
+}
+
+func TestValidateWebhookEdit(t *testing.T) {
+	t.Run("No change", func(t *testing.T) {
+		err := validateWebhookEdit(WebhookEdit{})
+
+		require.EqualError(t, err, "Webhook edit must change name or avatar")
+	})
+
+	t.Run("Name limit", func(t *testing.T) {
+		err := validateWebhookEdit(WebhookEdit{Name: strings.Repeat("t", WebhookNameLimit+1)})
+
+		require.EqualError(t, err, "Webhook name"+errorMsg)
+	})
+
+	t.Run("Pass", func(t *testing.T) {
+		err := validateWebhookEdit(WebhookEdit{Name: "alerts"})
+
+		require.NoError(t, err, "Pass failed")
+	})
+}
+
+func TestClientGetWebhook(t *testing.T) {
+	t.Run("Success", func(t *testing.T) {
+		var method string
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			method = r.Method
+			w.Write([]byte(`{"id": "1", "type": 1, "guild_id": "2", "channel_id": "3", "name": "alerts", "avatar": "abc", "token": "token"}`))
+		}))
+		defer server.Close()
+		c := &Client{url: server.URL, client: http.DefaultClient}
+
+		w, err := c.GetWebhook(context.Background())
+
+		require.NoError(t, err, "Success failed")
+		require.Equal(t, http.MethodGet, method, "Success failed")
+		require.Equal(t, &Webhook{ID: "1", Type: 1, GuildID: "2", ChannelID: "3", Name: "alerts", Avatar: "abc"}, w, "Success failed")
+	})
+
+	t.Run("Unknown webhook", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"message": "Unknown Webhook", "code": 10015}`))
+		}))
+		defer server.Close()
+		c := &Client{url: server.URL, client: http.DefaultClient}
+
+		w, err := c.GetWebhook(context.Background())
+
+		var apiErr *APIError
+		require.ErrorAs(t, err, &apiErr, "Unknown webhook failed")
+		require.Equal(t, CodeUnknownWebhook, apiErr.Code, "Unknown webhook failed")
+		require.Nil(t, w, "Unknown webhook failed")
+	})
+
+	t.Run("NewRequest error", func(t *testing.T) {
+		c := &Client{url: "%%", client: http.DefaultClient}
+
+		_, err := c.GetWebhook(context.Background())
+
+		require.Error(t, err, "NewRequest error failed")
+	})
+}
+
+func TestClientModifyWebhook(t *testing.T) {
+	t.Run("validateWebhookEdit error", func(t *testing.T) {
+		c := &Client{url: "https://discord.com/api/webhooks/1/token", client: http.DefaultClient}
+
+		_, err := c.ModifyWebhook(context.Background(), WebhookEdit{})
+
+		require.Error(t, err, "validateWebhookEdit error failed")
+	})
+
+	t.Run("NewRequest error", func(t *testing.T) {
+		c := &Client{url: "%%", client: http.DefaultClient}
+
+		_, err := c.ModifyWebhook(context.Background(), WebhookEdit{Name: "alerts"})
+
+		require.Error(t, err, "NewRequest error failed")
+	})
+
+	t.Run("Success", func(t *testing.T) {
+		var method string
+		var payload map[string]string
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			method = r.Method
+			json.NewDecoder(r.Body).Decode(&payload)
+			w.Write([]byte(`{"id": "1", "channel_id": "3", "name": "staging alerts", "avatar": "def"}`))
+		}))
+		defer server.Close()
+		c := &Client{url: server.URL, client: http.DefaultClient}
+		edit := WebhookEdit{Name: "staging alerts", Avatar: AvatarData("image/png", []byte("png"))}
+
+		w, err := c.ModifyWebhook(context.Background(), edit)
+
+		require.NoError(t, err, "Success failed")
+		require.Equal(t, http.MethodPatch, method, "Success failed")
+		require.Equal(t, map[string]string{"name": "staging alerts", "avatar": "data:image/png;base64,cG5n"}, payload, "Success failed")
+		require.Equal(t, "staging alerts", w.Name, "Success failed")
+		require.Equal(t, "def", w.Avatar, "Success failed")
+	})
+
+	t.Run("API error", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"message": "Invalid Form Body", "code": 50035}`))
+		}))
+		defer server.Close()
+		c := &Client{url: server.URL, client: http.DefaultClient}
+
+		w, err := c.ModifyWebhook(context.Background(), WebhookEdit{Name: "alerts"})
+
+		require.IsType(t, &APIError{}, err, "API error failed")
+		require.Nil(t, w, "API error failed")
+	})
+}
+
+func TestClientDeleteWebhook(t *testing.T) {
+	t.Run("Success", func(t *testing.T) {
+		var method string
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			method = r.Method
+			w.WriteHeader(http.StatusNoContent)
+		}))
+		defer server.Close()
+		c := &Client{url: server.URL, client: http.DefaultClient}
+
+		err := c.DeleteWebhook(context.Background())
+
+		require.NoError(t, err, "Success failed")
+		require.Equal(t, http.MethodDelete, method, "Success failed")
+	})
+
+	t.Run("NewRequest error", func(t *testing.T) {
+		c := &Client{url: "%%", client: http.DefaultClient}
+
+		err := c.DeleteWebhook(context.Background())
+
+		require.Error(t, err, "NewRequest error failed")
+	})
+}
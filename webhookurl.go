@@ -0,0 +1,136 @@
+package messenger
+
+import (
+	"errors"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// Hosts serving the Discord API, they are normalised to the first one.
+var webhookHosts = []string{
+	"discord.com",
+	"discordapp.com",
+	"ptb.discord.com",
+	"ptb.discordapp.com",
+	"canary.discord.com",
+	"canary.discordapp.com",
+}
+
+// WebhookURL is a Discord webhook url parsed into its id and token.
+type WebhookURL struct {
+	ID    string
+	Token string
+	// APIVersion is the API version in the url path, 0 for the unversioned API.
+	APIVersion int
+}
+
+// NewWebhookURL creates a WebhookURL from webhook id and token.
+func NewWebhookURL(id, token string) (WebhookURL, error) {
+	w := WebhookURL{ID: id, Token: token}
+	if err := w.validate(); err != nil {
+		return WebhookURL{}, err
+	}
+	return w, nil
+}
+
+// ParseWebhookURL parses a webhook url copied from Discord. Hosts of the
+// discordapp.com domain and the ptb and canary clients are accepted, as well as
+// versioned API paths. Query and fragment are dropped.
+func ParseWebhookURL(rawURL string) (WebhookURL, error) {
+	return parseWebhookURL(rawURL, nil)
+}
+
+// parseWebhookURL is like ParseWebhookURL but also accepts webhook urls under
+// base, the API base url set with WithBaseURL.
+func parseWebhookURL(rawURL string, base *url.URL) (WebhookURL, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return WebhookURL{}, errors.New("invalid webhook URL")
+	}
+
+	var path string
+	switch {
+	case base != nil && u.Scheme == base.Scheme && u.Host == base.Host && strings.HasPrefix(u.Path, base.Path+"/"):
+		path = strings.TrimPrefix(u.Path, base.Path)
+	case u.Scheme == "https" && isWebhookHost(u.Host) && strings.HasPrefix(u.Path, "/api/"):
+		path = strings.TrimPrefix(u.Path, "/api")
+	default:
+		return WebhookURL{}, errors.New("invalid webhook URL: not a Discord API URL")
+	}
+
+	// [/v10]/webhooks/{id}/{token}
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+	var w WebhookURL
+	if strings.HasPrefix(segments[0], "v") {
+		v, err := strconv.Atoi(segments[0][1:])
+		if err != nil || v < 1 {
+			return WebhookURL{}, errors.New("invalid webhook URL: invalid API version")
+		}
+		w.APIVersion = v
+		segments = segments[1:]
+	}
+	if len(segments) != 3 || segments[0] != "webhooks" {
+		return WebhookURL{}, errors.New("invalid webhook URL: missing webhook ID or token")
+	}
+	w.ID, w.Token = segments[1], segments[2]
+
+	if err := w.validate(); err != nil {
+		return WebhookURL{}, err
+	}
+	return w, nil
+}
+
+// parseBaseURL parses the API base url set with WithBaseURL, nil when it is
+// not set.
+func parseBaseURL(rawURL string) (*url.URL, error) {
+	if rawURL == "" {
+		return nil, nil
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, errors.New("invalid base URL")
+	}
+	return &url.URL{Scheme: u.Scheme, User: u.User, Host: u.Host, Path: strings.TrimSuffix(u.Path, "/")}, nil
+}
+
+func isWebhookHost(host string) bool {
+	for _, h := range webhookHosts {
+		if host == h {
+			return true
+		}
+	}
+	return false
+}
+
+// validate checks the id is a snowflake and the token only holds the
+// characters Discord generates tokens with.
+func (w WebhookURL) validate() error {
+	if w.ID == "" || len(w.ID) > 20 || strings.Trim(w.ID, "0123456789") != "" {
+		return errors.New("invalid webhook URL: invalid webhook ID")
+	}
+	if w.Token == "" || strings.IndexFunc(w.Token, func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_' || r == '.')
+	}) != -1 {
+		return errors.New("invalid webhook URL: invalid webhook token")
+	}
+	if w.APIVersion < 0 {
+		return errors.New("invalid webhook URL: invalid API version")
+	}
+	return nil
+}
+
+// URL returns the normalised url of the webhook on discord.com.
+func (w WebhookURL) URL() string {
+	return w.urlOn(&url.URL{Scheme: "https", Host: webhookHosts[0], Path: "/api"})
+}
+
+// urlOn returns the url of the webhook under the API base url.
+func (w WebhookURL) urlOn(base *url.URL) string {
+	u := *base
+	if w.APIVersion > 0 {
+		u.Path += "/v" + strconv.Itoa(w.APIVersion)
+	}
+	u.Path += "/webhooks/" + w.ID + "/" + w.Token
+	return u.String()
+}
@@ -0,0 +1,157 @@
+package messenger
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewWebhookURL(t *testing.T) {
+	t.Run("Invalid ID", func(t *testing.T) {
+		_, err := NewWebhookURL("abc", "token")
+
+		require.EqualError(t, err, "invalid webhook URL: invalid webhook ID")
+	})
+
+	t.Run("Invalid token", func(t *testing.T) {
+		_, err := NewWebhookURL("123", "to/ken")
+
+		require.EqualError(t, err, "invalid webhook URL: invalid webhook token")
+	})
+
+	t.Run("Pass", func(t *testing.T) {
+		w, err := NewWebhookURL("123", "Ab-c_9.x")
+
+		require.NoError(t, err, "Pass failed")
+		require.Equal(t, WebhookURL{ID: "123", Token: "Ab-c_9.x"}, w, "Pass failed")
+	})
+}
+
+func TestParseWebhookURL(t *testing.T) {
+	valid := []struct {
+		url      string
+		expected WebhookURL
+	}{
+		{"https://discord.com/api/webhooks/123/token", WebhookURL{ID: "123", Token: "token"}},
+		{"https://discordapp.com/api/webhooks/123/token", WebhookURL{ID: "123", Token: "token"}},
+		{"https://ptb.discord.com/api/webhooks/123/token", WebhookURL{ID: "123", Token: "token"}},
+		{"https://canary.discord.com/api/webhooks/123/token", WebhookURL{ID: "123", Token: "token"}},
+		{"https://discord.com/api/v10/webhooks/123/token", WebhookURL{ID: "123", Token: "token", APIVersion: 10}},
+		{"https://discord.com/api/webhooks/123/token/?wait=true", WebhookURL{ID: "123", Token: "token"}},
+	}
+	for _, v := range valid {
+		t.Run(v.url, func(t *testing.T) {
+			w, err := ParseWebhookURL(v.url)
+
+			require.NoError(t, err, "Parse webhook URL failed")
+			require.Equal(t, v.expected, w, "Parse webhook URL failed")
+		})
+	}
+
+	invalid := []struct {
+		url string
+		err string
+	}{
+		{"%%", "invalid webhook URL"},
+		{"http://discord.com/api/webhooks/123/token", "invalid webhook URL: not a Discord API URL"},
+		{"https://example.com/api/webhooks/123/token", "invalid webhook URL: not a Discord API URL"},
+		{"https://discord.com/webhooks/123/token", "invalid webhook URL: not a Discord API URL"},
+		{"https://discord.com/api/vx/webhooks/123/token", "invalid webhook URL: invalid API version"},
+		{"https://discord.com/api/webhooks/", "invalid webhook URL: missing webhook ID or token"},
+		{"https://discord.com/api/webhooks/123", "invalid webhook URL: missing webhook ID or token"},
+		{"https://discord.com/api/channels/123/token", "invalid webhook URL: missing webhook ID or token"},
+		{"https://discord.com/api/webhooks/abc/token", "invalid webhook URL: invalid webhook ID"},
+	}
+	for _, v := range invalid {
+		t.Run(v.url, func(t *testing.T) {
+			_, err := ParseWebhookURL(v.url)
+
+			require.EqualError(t, err, v.err)
+		})
+	}
+}
+
+func TestParseWebhookURLBase(t *testing.T) {
+	base := &url.URL{Scheme: "http", Host: "127.0.0.1:8080", Path: "/api"}
+
+	valid := []struct {
+		url      string
+		expected WebhookURL
+	}{
+		{"http://127.0.0.1:8080/api/webhooks/123/token", WebhookURL{ID: "123", Token: "token"}},
+		{"http://127.0.0.1:8080/api/v10/webhooks/123/token", WebhookURL{ID: "123", Token: "token", APIVersion: 10}},
+		{"https://discord.com/api/webhooks/123/token", WebhookURL{ID: "123", Token: "token"}},
+	}
+	for _, v := range valid {
+		t.Run(v.url, func(t *testing.T) {
+			w, err := parseWebhookURL(v.url, base)
+
+			require.NoError(t, err, "Parse webhook URL failed")
+			require.Equal(t, v.expected, w, "Parse webhook URL failed")
+		})
+	}
+
+	invalid := []struct {
+		url string
+		err string
+	}{
+		{"https://127.0.0.1:8080/api/webhooks/123/token", "invalid webhook URL: not a Discord API URL"},
+		{"http://127.0.0.1:9090/api/webhooks/123/token", "invalid webhook URL: not a Discord API URL"},
+		{"http://127.0.0.1:8080/apiv/webhooks/123/token", "invalid webhook URL: not a Discord API URL"},
+		{"http://127.0.0.1:8080/api/webhooks/123", "invalid webhook URL: missing webhook ID or token"},
+	}
+	for _, v := range invalid {
+		t.Run(v.url, func(t *testing.T) {
+			_, err := parseWebhookURL(v.url, base)
+
+			require.EqualError(t, err, v.err)
+		})
+	}
+}
+
+func TestParseBaseURL(t *testing.T) {
+	t.Run("Empty", func(t *testing.T) {
+		u, err := parseBaseURL("")
+
+		require.NoError(t, err, "Empty failed")
+		require.Nil(t, u, "Empty failed")
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		for _, raw := range []string{"%%", "127.0.0.1:8080", "ftp://127.0.0.1", "http:///api"} {
+			_, err := parseBaseURL(raw)
+
+			require.EqualError(t, err, "invalid base URL", raw)
+		}
+	})
+
+	t.Run("Pass", func(t *testing.T) {
+		u, err := parseBaseURL("http://127.0.0.1:8080/api/?x=1")
+
+		require.NoError(t, err, "Pass failed")
+		require.Equal(t, "http://127.0.0.1:8080/api", u.String(), "Pass failed")
+	})
+}
+
+func TestWebhookURLURL(t *testing.T) {
+	t.Run("Unversioned", func(t *testing.T) {
+		w := WebhookURL{ID: "123", Token: "token"}
+
+		require.Equal(t, "https://discord.com/api/webhooks/123/token", w.URL(), "Unversioned failed")
+	})
+
+	t.Run("Versioned", func(t *testing.T) {
+		w := WebhookURL{ID: "123", Token: "token", APIVersion: 10}
+
+		require.Equal(t, "https://discord.com/api/v10/webhooks/123/token", w.URL(), "Versioned failed")
+	})
+
+	t.Run("Base URL", func(t *testing.T) {
+		w := WebhookURL{ID: "123", Token: "token", APIVersion: 10}
+
+		u := w.urlOn(&url.URL{Scheme: "http", Host: "127.0.0.1:8080", Path: "/api"})
+
+		require.Equal(t, "http://127.0.0.1:8080/api/v10/webhooks/123/token", u, "Base URL failed")
+	})
+}